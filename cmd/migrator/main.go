@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"sparky-back/internal/config"
@@ -9,30 +11,190 @@ import (
 	"sparky-back/internal/models"
 )
 
-const configEnv = "CONFIG"
-
 func main() {
-	configPath, ok := os.LookupEnv(configEnv)
-	if !ok {
-		panic("no config env")
+	cfg, err := config.Load(os.Args[1:])
+	if err == nil {
+		err = cfg.ValidateDatabase()
+	}
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "config initialization: %v\n", err)
+		os.Exit(1)
+	}
+	// migrations rewrite whole tables, the request statement timeout does not apply to them
+	cfg.Database.StatementTimeout = 0
+	db, err := loader.New(context.Background(), cfg.Database)
+	if err != nil {
+		panic(fmt.Sprintf("database initialization: %v", err))
+	}
+	defer db.Close()
+	_, err = db.NewCreateTable().
+		Model(&models.Message{}).
+		IfNotExists().
+		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create messages table: %v", err))
+	}
+	_, err = db.Exec(`
+		ALTER TABLE messages
+		    ADD COLUMN IF NOT EXISTS delivered_at timestamptz,
+		    ADD COLUMN IF NOT EXISTS read_at timestamptz
+	`)
+	if err != nil {
+		panic(fmt.Sprintf("add messages receipt columns: %v", err))
+	}
+	_, err = db.Exec(`
+		ALTER TABLE messages
+		    ADD COLUMN IF NOT EXISTS edited_at timestamptz,
+		    ADD COLUMN IF NOT EXISTS deleted_at timestamptz
+	`)
+	if err != nil {
+		panic(fmt.Sprintf("add messages edit columns: %v", err))
 	}
-	cfg, err := config.Load(configPath)
+	_, err = db.NewCreateTable().
+		Model(&models.MessageEdit{}).
+		IfNotExists().
+		ForeignKey(`(message_id) REFERENCES messages(id) ON DELETE CASCADE`).
+		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create message_edits table: %v", err))
+	}
+	_, err = db.NewCreateIndex().
+		Model(&models.MessageEdit{}).
+		Index("message_edits_message_id_idx").
+		Column("message_id").
+		IfNotExists().
+		Exec(context.Background())
 	if err != nil {
-		panic(fmt.Sprintf("config initialization: %v", err))
+		panic(fmt.Sprintf("create message_edits index: %v", err))
 	}
-	db := loader.New(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.DBName)
 	_, err = db.NewCreateTable().
+		Model(&models.Attachment{}).
+		IfNotExists().
+		ForeignKey(`(message_id) REFERENCES messages(id) ON DELETE CASCADE`).
+		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create attachments table: %v", err))
+	}
+	_, err = db.NewCreateIndex().
+		Model(&models.Attachment{}).
+		Index("attachments_message_id_idx").
+		Column("message_id").
+		IfNotExists().
+		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create attachments index: %v", err))
+	}
+	_, err = db.Exec(`ALTER TABLE messages ADD COLUMN IF NOT EXISTS client_id varchar`)
+	if err != nil {
+		panic(fmt.Sprintf("add messages client_id column: %v", err))
+	}
+	// retried sends are found by the id the client generated
+	_, err = db.NewCreateIndex().
+		Model(&models.Message{}).
+		Unique().
+		Index("messages_user_id_client_id_idx").
+		Column("user_id", "client_id").
+		IfNotExists().
+		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create messages client id index: %v", err))
+	}
+	// the generated column follows inserts and edits by itself
+	_, err = db.Exec(`
+		ALTER TABLE messages
+		    ADD COLUMN IF NOT EXISTS search tsvector
+		    GENERATED ALWAYS AS (to_tsvector('simple', coalesce(text, ''))) STORED
+	`)
+	if err != nil {
+		panic(fmt.Sprintf("add messages search column: %v", err))
+	}
+	_, err = db.Exec(`CREATE INDEX IF NOT EXISTS messages_search_idx ON messages USING GIN (search)`)
+	if err != nil {
+		panic(fmt.Sprintf("create messages search index: %v", err))
+	}
+	// conversation history is read by (sender, receiver) pairs in id order
+	_, err = db.NewCreateIndex().
+		Model(&models.Message{}).
+		Index("messages_user_id_to_id_id_idx").
+		Column("user_id", "to_id", "id").
+		IfNotExists().
+		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create messages sender index: %v", err))
+	}
+	_, err = db.NewCreateIndex().
 		Model(&models.Message{}).
+		Index("messages_to_id_user_id_id_idx").
+		Column("to_id", "user_id", "id").
 		IfNotExists().
 		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create messages receiver index: %v", err))
+	}
 	_, err = db.NewCreateTable().
 		Model(&models.Reaction{}).
 		IfNotExists().
 		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create reactions table: %v", err))
+	}
 	_, err = db.NewCreateTable().
 		Model(&models.User{}).
 		IfNotExists().
 		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create users table: %v", err))
+	}
+	_, err = db.Exec(`
+		ALTER TABLE users
+		    ADD COLUMN IF NOT EXISTS hide_presence boolean NOT NULL DEFAULT false,
+		    ADD COLUMN IF NOT EXISTS last_seen_at timestamptz,
+		    ADD COLUMN IF NOT EXISTS online_until timestamptz
+	`)
+	if err != nil {
+		panic(fmt.Sprintf("add users presence columns: %v", err))
+	}
+	_, err = db.NewCreateTable().
+		Model(&models.Photo{}).
+		IfNotExists().
+		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create photos table: %v", err))
+	}
+	_, err = db.Exec(`ALTER TABLE photos ADD COLUMN IF NOT EXISTS sizes bigint[]`)
+	if err != nil {
+		panic(fmt.Sprintf("add photos sizes column: %v", err))
+	}
+	_, err = db.NewCreateIndex().
+		Model(&models.Photo{}).
+		Index("photos_user_id_position_idx").
+		Column("user_id", "position").
+		IfNotExists().
+		Exec(context.Background())
+	if err != nil {
+		panic(fmt.Sprintf("create photos index: %v", err))
+	}
+	// users.img_path was replaced with the photos table, its value becomes the primary photo
+	_, err = db.Exec(`
+		DO $$
+		BEGIN
+		    IF EXISTS (SELECT 1 FROM information_schema.columns
+		               WHERE table_name = 'users' AND column_name = 'img_path') THEN
+		        INSERT INTO photos (user_id, path, position, is_primary)
+		        SELECT u.id, regexp_replace(u.img_path, '^static/', ''), 0, true
+		        FROM users u
+		        WHERE u.img_path <> ''
+		          AND NOT EXISTS (SELECT 1 FROM photos p WHERE p.user_id = u.id);
+		        ALTER TABLE users DROP COLUMN img_path;
+		    END IF;
+		END $$;
+	`)
+	if err != nil {
+		panic(fmt.Sprintf("migrate users img_path: %v", err))
+	}
 	_, err = db.Exec(`
 		CREATE OR REPLACE FUNCTION calculate_distance(lat1 float, lon1 float, lat2 float, lon2 float, units varchar)
 		RETURNS float AS $dist$
@@ -69,5 +231,9 @@ func main() {
 	if err != nil {
 		panic(err)
 	}
+	err = loader.SetSchemaVersion(context.Background(), db)
+	if err != nil {
+		panic(fmt.Sprintf("set schema version: %v", err))
+	}
 	fmt.Println("successful migration")
 }
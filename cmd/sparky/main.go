@@ -1,18 +1,20 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"os"
 	"sparky-back/internal/app"
 )
 
-const configEnv = "CONFIG"
-
 func main() {
-	val, ok := os.LookupEnv(configEnv)
-	if !ok {
-		panic("no config env")
+	err := app.Run(os.Args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	if err := app.Run(val); err != nil {
-		panic(err)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -1,20 +1,38 @@
 package app
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/uptrace/bunrouter"
+	"go.uber.org/zap"
 	"net/http"
+	"os/signal"
 	"sparky-back/internal/config"
 	"sparky-back/internal/controllers"
+	"sparky-back/internal/health"
+	"sparky-back/internal/hub"
 	"sparky-back/internal/loader"
 	"sparky-back/internal/logic"
+	"sparky-back/internal/metrics"
 	"sparky-back/internal/middlewares"
+	"sparky-back/internal/pubsub"
+	"sparky-back/internal/tracing"
+	"sparky-back/pkg/blobstore"
+	"sparky-back/pkg/urlsign"
 	"sparky-back/pkg/zaplogger"
+	"syscall"
+	"time"
 )
 
-func Run(configPath string) error {
-	cfg, err := config.Load(configPath)
+const clientBufSize = 100
+
+// Run starts the server, args are the command line flags, see config.Load.
+func Run(args []string) error {
+	cfg, err := config.Load(args)
+	if err == nil {
+		err = cfg.Validate()
+	}
 	if err != nil {
 		return fmt.Errorf("config initialization: %w", err)
 	}
@@ -23,29 +41,143 @@ func Run(configPath string) error {
 		return fmt.Errorf("zaplogger initialization: %w", err)
 	}
 	defer zapsync()
-	l := logic.NewLogic(loader.New(cfg.Database.Host, cfg.Database.Port, cfg.Database.User, cfg.Database.Password, cfg.Database.DBName))
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	// background work stops only after the server has finished the requests in flight
+	bgCtx, cancelBg := context.WithCancel(context.Background())
+	defer cancelBg()
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		return fmt.Errorf("tracing initialization: %w", err)
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			zap.S().Error(fmt.Errorf("flushing spans: %w", err))
+		}
+	}()
+	store, err := blobstore.New(context.Background(), cfg.Storage)
+	if err != nil {
+		return fmt.Errorf("blob store initialization: %w", err)
+	}
+	signer := urlsign.New([]byte(cfg.Media.SigningKey), cfg.Media.URLTTL)
+	db, err := loader.New(ctx, cfg.Database)
+	if err != nil {
+		return fmt.Errorf("database initialization: %w", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			zap.S().Error(fmt.Errorf("closing database: %w", err))
+		}
+	}()
+	db.AddQueryHook(metrics.QueryHook{})
+	db.AddQueryHook(tracing.QueryHook{})
+	h := hub.New(clientBufSize)
+	metrics.RegisterChat(h)
+	ps, err := pubsub.New(cfg.PubSub, db, h.Publish, func(userID int64) bool {
+		return h.Connections(userID) > 0
+	})
+	if err != nil {
+		return fmt.Errorf("pubsub initialization: %w", err)
+	}
+	psDone := make(chan struct{})
+	go func() {
+		defer close(psDone)
+		if err := ps.Run(bgCtx); err != nil && bgCtx.Err() == nil {
+			zap.S().Error(fmt.Errorf("running pubsub: %w", err))
+		}
+	}()
+	l := logic.NewLogic(db, logic.NewPhotoService(db, store, signer, cfg.Media.PublicPhotos), logic.NewAttachmentService(db, store, signer), h, ps)
 	c := controllers.New(l)
+	checker := health.New()
+	checker.Add("database", func(ctx context.Context) error {
+		return db.PingContext(ctx)
+	})
+	checker.Add("storage", func(ctx context.Context) error {
+		return blobstore.CheckWritable(ctx, store)
+	})
+	checker.Add("schema", func(ctx context.Context) error {
+		return loader.CheckSchemaVersion(ctx, db)
+	})
+	checker.Add("pubsub", ps.Check)
+	hc := controllers.NewHealth(checker)
+	go func() {
+		removed, err := l.CleanOrphanFiles(bgCtx)
+		if err != nil {
+			zap.S().With("removed", removed).Error(fmt.Errorf("cleaning orphan files: %w", err))
+			return
+		}
+		zap.S().With("removed", removed).Info("orphan files cleaned")
+	}()
 
 	router := bunrouter.New(
-		bunrouter.Use(middlewares.Log),
+		bunrouter.Use(middlewares.Tracing, middlewares.Metrics, middlewares.Log, middlewares.Recover),
 	)
+	router.GET("/healthz", hc.Liveness)
+	router.GET("/readyz", hc.Readiness)
+	router.GET("/metrics", bunrouter.HTTPHandler(metrics.Handler()))
 	router.POST("/signup", c.AddUser)
 	router.POST("/signin", c.Login)
 	router.POST("/update", c.UpdateUser)
 	router.GET("/user", c.GetUser)
+	router.POST("/photo", c.AddPhoto)
+	router.POST("/photo/order", c.ReorderPhotos)
+	router.POST("/photo/delete", c.DeletePhoto)
 	router.GET("/static/:filename", c.GetFile)
+	router.GET("/attachment/:id", c.GetAttachment)
 	router.POST("/reaction", c.SetReaction)
+	router.GET("/connection", c.ClientConnection)
 	router.POST("/connection", c.ClientConnection)
+	router.GET("/ws", c.WebSocket)
 	router.POST("/message", c.NewMessage)
+	router.POST("/message/read", c.MarkRead)
+	router.POST("/typing", c.Typing)
+	router.POST("/message/edit", c.EditMessage)
+	router.POST("/message/delete", c.DeleteMessage)
+	router.GET("/conversations", c.GetConversations)
+	router.GET("/conversations/:id/messages", c.GetConversationMessages)
+	router.GET("/search", c.SearchMessages)
 	router.POST("/recommendations", c.GetRecommendations)
 	handler := http.HandlerFunc(router.ServeHTTP)
 	httpServer := &http.Server{
 		Addr:    fmt.Sprintf(":%d", cfg.Server.Port),
 		Handler: handler,
 	}
-	if err = httpServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
-		return err
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- httpServer.ListenAndServe()
+	}()
+	select {
+	case err = <-serverErr:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
 	}
+	// a second signal kills the process
+	stop()
 
+	zap.S().With("delay", cfg.Server.ShutdownDelay, "timeout", cfg.Server.ShutdownTimeout).Info("shutting down")
+	// readiness fails first, so the load balancer stops routing here before the listener closes
+	checker.SetShuttingDown()
+	time.Sleep(cfg.Server.ShutdownDelay)
+	// the timeout starts after the delay, it is all for the requests in flight
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	// live chat connections never end by themselves, Shutdown would wait for them until the timeout
+	h.Close()
+	if err = httpServer.Shutdown(shutdownCtx); err != nil {
+		zap.S().Error(fmt.Errorf("shutting down http server: %w", err))
+		httpServer.Close()
+	}
+	// WebSocket handlers still save the events they are handling, the database must outlive them
+	if err = c.WaitWebSockets(shutdownCtx); err != nil {
+		zap.S().Error(fmt.Errorf("waiting for websocket connections: %w", err))
+	}
+	// pubsub holds a database connection, the deferred calls close the database after it
+	cancelBg()
+	<-psDone
 	return nil
 }
@@ -1,40 +1,237 @@
 package config
 
 import (
+	"errors"
+	"flag"
 	"fmt"
 	"gopkg.in/yaml.v3"
+	"io"
 	"os"
+	"sparky-back/internal/loader"
+	"sparky-back/internal/pubsub"
+	"sparky-back/internal/tracing"
+	"sparky-back/pkg/blobstore"
 	"sparky-back/pkg/zaplogger"
+	"strings"
+	"time"
+)
+
+const (
+	// configEnv is the path of the config file when the config flag is not given
+	configEnv  = "CONFIG"
+	configFlag = "config"
 )
 
 type Config struct {
 	Server   ServerConfig     `yaml:"server"`
-	Logger   zaplogger.Config `yaml:"zaplogger"`
-	Database DatabaseConfig   `yaml:"database"`
+	Logger   zaplogger.Config `yaml:"logger"`
+	Database loader.Config    `yaml:"database"`
+	Storage  blobstore.Config `yaml:"storage"`
+	Media    MediaConfig      `yaml:"media"`
+	PubSub   pubsub.Config    `yaml:"pubsub"`
+	Tracing  tracing.Config   `yaml:"tracing"`
 }
 
-func Load(filename string) (*Config, error) {
-	file, err := os.ReadFile(filename)
-	if err != nil {
-		return nil, fmt.Errorf("read config file: %w", err)
+// Default is the config every layer is applied on top of.
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Port:            8080,
+			ShutdownTimeout: 30 * time.Second,
+		},
+		Logger: zaplogger.Config{
+			Level: "info",
+		},
+		Database: loader.Config{
+			Host:             "localhost",
+			Port:             5432,
+			User:             "postgres",
+			DBName:           "sparky",
+			SSLMode:          "disable",
+			ApplicationName:  "sparky-back",
+			MaxOpenConns:     20,
+			MaxIdleConns:     10,
+			ConnMaxLifetime:  30 * time.Minute,
+			ConnMaxIdleTime:  5 * time.Minute,
+			StatementTimeout: 30 * time.Second,
+			ConnectTimeout:   30 * time.Second,
+		},
+		Storage: blobstore.Config{
+			Backend: blobstore.BackendLocal,
+			Local:   blobstore.LocalConfig{Dir: "static/"},
+		},
+		Media: MediaConfig{
+			URLTTL: time.Hour,
+		},
+		PubSub: pubsub.Config{
+			Backend: pubsub.BackendLocal,
+		},
+		Tracing: tracing.Config{
+			Exporter: tracing.ExporterNone,
+		},
 	}
-	cfg := Config{}
-	err = yaml.Unmarshal(file, &cfg)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshal config file: %w", err)
+}
+
+// Load builds the config from the defaults, the yaml file, the SPARKY_* environment
+// variables and the command line flags, each layer overriding the previous one.
+// The file is given by the -config flag or the CONFIG variable, it is optional.
+// A key database.password is set by SPARKY_DATABASE_PASSWORD and -database.password.
+// The caller validates the sections it uses, see Validate.
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+	keys := configKeys(&cfg)
+
+	fs := flag.NewFlagSet("sparky", flag.ContinueOnError)
+	filename := fs.String(configFlag, os.Getenv(configEnv), "path of the yaml config file")
+	flags := defineFlags(fs, keys)
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments %q", fs.Args())
 	}
 
+	if *filename != "" {
+		if err := loadFile(*filename, &cfg); err != nil {
+			return nil, err
+		}
+	}
+	if err := applyEnv(&cfg, keys, os.Environ()); err != nil {
+		return nil, err
+	}
+	if err := applyFlags(&cfg, fs, keys, flags); err != nil {
+		return nil, err
+	}
+	if err := cfg.readSecrets(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
 
+// loadFile rejects keys the config does not have, a typo must not silently leave a default.
+func loadFile(filename string, cfg *Config) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+	defer file.Close()
+	dec := yaml.NewDecoder(file)
+	dec.KnownFields(true)
+	err = dec.Decode(cfg)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("unmarshal config file %s: %w", filename, err)
+	}
+	return nil
+}
+
+// readSecrets replaces the secrets given as files with the file contents.
+func (c *Config) readSecrets() error {
+	secrets := []struct {
+		key   string
+		value *string
+		file  string
+	}{
+		{"database.password", &c.Database.Password, c.Database.PasswordFile},
+		{"media.signing_key", &c.Media.SigningKey, c.Media.SigningKeyFile},
+		{"storage.s3.secret_key", &c.Storage.S3.SecretKey, c.Storage.S3.SecretKeyFile},
+	}
+	for _, s := range secrets {
+		if s.file == "" {
+			continue
+		}
+		if *s.value != "" {
+			return fmt.Errorf("%s and %s_file are both set", s.key, s.key)
+		}
+		data, err := os.ReadFile(s.file)
+		if err != nil {
+			return fmt.Errorf("read %s_file: %w", s.key, err)
+		}
+		*s.value = strings.TrimRight(string(data), "\r\n")
+	}
+	return nil
+}
+
+// Validate checks the config of the server and reports every missing or invalid value at once.
+func (c *Config) Validate() error {
+	var v validator
+	v.server(c.Server)
+	v.database(c.Database)
+	if c.Storage.Backend == blobstore.BackendS3 {
+		v.required("storage.s3.endpoint", c.Storage.S3.Endpoint)
+		v.required("storage.s3.bucket", c.Storage.S3.Bucket)
+	}
+	// attachment urls are signed even with public photos
+	v.required("media.signing_key", c.Media.SigningKey)
+	if c.Media.URLTTL <= 0 {
+		v.add(fmt.Errorf("media.url_ttl must be positive"))
+	}
+	return v.err()
+}
+
+// ValidateDatabase checks only the database section, for tools that need nothing else.
+func (c *Config) ValidateDatabase() error {
+	var v validator
+	v.database(c.Database)
+	return v.err()
+}
+
+type validator struct {
+	errs []error
+}
+
+func (v *validator) add(err error) {
+	v.errs = append(v.errs, err)
+}
+
+func (v *validator) required(key, value string) {
+	if value == "" {
+		v.add(fmt.Errorf("%s is required", key))
+	}
+}
+
+func (v *validator) server(c ServerConfig) {
+	if c.Port <= 0 || c.Port > 65535 {
+		v.add(fmt.Errorf("server.port %d is out of range", c.Port))
+	}
+	if c.ShutdownDelay < 0 || c.ShutdownTimeout <= 0 {
+		v.add(fmt.Errorf("server.shutdown_delay and server.shutdown_timeout must be positive"))
+	}
+	if c.ShutdownDelay >= c.ShutdownTimeout {
+		v.add(fmt.Errorf("server.shutdown_delay %s must be shorter than server.shutdown_timeout %s", c.ShutdownDelay, c.ShutdownTimeout))
+	}
+}
+
+func (v *validator) database(c loader.Config) {
+	v.required("database.host", c.Host)
+	v.required("database.user", c.User)
+	v.required("database.dbname", c.DBName)
+	if c.Port <= 0 || c.Port > 65535 {
+		v.add(fmt.Errorf("database.port %d is out of range", c.Port))
+	}
+	if err := c.Validate(); err != nil {
+		v.add(fmt.Errorf("database: %w", err))
+	}
+}
+
+func (v *validator) err() error {
+	if err := errors.Join(v.errs...); err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	return nil
+}
+
 type ServerConfig struct {
 	Port int `yaml:"port"`
+	// ShutdownDelay is how long the server stays up not ready on SIGTERM,
+	// ShutdownTimeout then bounds waiting for requests in flight, so a SIGTERM
+	// takes up to their sum; the grace period of the orchestrator must be longer
+	ShutdownDelay   time.Duration `yaml:"shutdown_delay"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout"`
 }
 
-type DatabaseConfig struct {
-	Host     string `yaml:"host"`
-	Port     int    `yaml:"port"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	DBName   string `yaml:"dbname"`
+type MediaConfig struct {
+	SigningKey     string        `yaml:"signing_key"`
+	SigningKeyFile string        `yaml:"signing_key_file"`
+	URLTTL         time.Duration `yaml:"url_ttl"`
+	PublicPhotos   bool          `yaml:"public_photos"`
 }
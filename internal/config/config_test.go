@@ -0,0 +1,143 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoad_Layers(t *testing.T) {
+	t.Setenv(configEnv, "")
+	path := writeFile(t, "config.yaml", `
+server:
+  port: 9000
+  shutdown_delay: 5s
+logger:
+  level: debug
+  file:
+    filename: sparky.log
+database:
+  host: db
+  port: 6000
+`)
+	t.Setenv("SPARKY_DATABASE_PORT", "7000")
+	t.Setenv("SPARKY_DATABASE_HOST", "env-db")
+	t.Setenv("SPARKY_DATABASE_PASSWORD_FILE", writeFile(t, "password", "s3cr#t\n"))
+
+	cfg, err := Load([]string{"-config", path, "-media.public_photos", "-database.port", "8000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Server.ShutdownDelay != 5*time.Second {
+		t.Errorf("file values not applied: %+v", cfg.Server)
+	}
+	if cfg.Server.ShutdownTimeout != 30*time.Second || cfg.Database.User != "postgres" {
+		t.Errorf("defaults not kept: %+v, %+v", cfg.Server, cfg.Database)
+	}
+	if cfg.Logger.File == nil || cfg.Logger.File.Filename != "sparky.log" {
+		t.Errorf("got logger %+v, want the file section", cfg.Logger)
+	}
+	if cfg.Database.Host != "env-db" {
+		t.Errorf("got host %q, want the variable to override the file", cfg.Database.Host)
+	}
+	if cfg.Database.Port != 8000 {
+		t.Errorf("got port %d, want the flag to override the variable", cfg.Database.Port)
+	}
+	if !cfg.Media.PublicPhotos {
+		t.Error("got public_photos unset, want the bool flag to set it")
+	}
+	if cfg.Database.Password != "s3cr#t" {
+		t.Errorf("got password %q, want the secret file contents", cfg.Database.Password)
+	}
+}
+
+func TestLoad_Errors(t *testing.T) {
+	t.Setenv(configEnv, "")
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		args []string
+		want string
+	}{
+		{
+			name: "unknown file key",
+			file: "logger:\n  levle: debug\n",
+			want: "field levle not found",
+		},
+		{
+			name: "unknown variable",
+			env:  map[string]string{"SPARKY_DATABASE_PASWORD": "x"},
+			want: "unknown config variable SPARKY_DATABASE_PASWORD",
+		},
+		{
+			name: "unknown flag",
+			args: []string{"-database.pasword", "x"},
+			want: "flag provided but not defined",
+		},
+		{
+			name: "bad value",
+			env:  map[string]string{"SPARKY_SERVER_PORT": "http"},
+			want: "variable SPARKY_SERVER_PORT: parse server.port",
+		},
+		{
+			name: "secret twice",
+			env:  map[string]string{"SPARKY_DATABASE_PASSWORD": "x", "SPARKY_DATABASE_PASSWORD_FILE": "password"},
+			want: "database.password and database.password_file are both set",
+		},
+		{
+			name: "shutdown delay",
+			args: []string{"-server.shutdown_delay", "30s", "-server.shutdown_timeout", "30s"},
+			want: "server.shutdown_delay 30s must be shorter than server.shutdown_timeout 30s",
+		},
+		{
+			name: "required",
+			args: []string{"-database.host", "", "-server.port", "0"},
+			want: "server.port 0 is out of range\ndatabase.host is required\nmedia.signing_key is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args := tt.args
+			if tt.file != "" {
+				args = append([]string{"-config", writeFile(t, "config.yaml", tt.file)}, args...)
+			}
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := Load(args)
+			if err == nil {
+				err = cfg.Validate()
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got error %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfig_ValidateDatabase(t *testing.T) {
+	cfg := Default()
+	cfg.Storage.Backend = "s3"
+	if err := cfg.Validate(); err == nil {
+		t.Error("got no error for the server without a signing key and s3 settings")
+	}
+	if err := cfg.ValidateDatabase(); err != nil {
+		t.Errorf("got %v, want the database section alone to be valid", err)
+	}
+	cfg.Database.Host = ""
+	if err := cfg.ValidateDatabase(); err == nil || !strings.Contains(err.Error(), "database.host is required") {
+		t.Errorf("got %v, want database.host required", err)
+	}
+}
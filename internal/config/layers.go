@@ -0,0 +1,142 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"reflect"
+	"strings"
+)
+
+const envPrefix = "SPARKY_"
+
+// key is a leaf of the config, such as database.port, with the path of struct fields to it.
+type key struct {
+	name   string
+	index  []int
+	isBool bool
+}
+
+func (k key) env() string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(k.name, ".", "_"))
+}
+
+// configKeys lists the leaves of the config by their yaml names.
+func configKeys(cfg *Config) []key {
+	return appendKeys(nil, reflect.TypeOf(cfg).Elem(), "", nil)
+}
+
+func appendKeys(keys []key, t reflect.Type, prefix string, index []int) []key {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" || !field.IsExported() {
+			continue
+		}
+		fieldIndex := append(append([]int(nil), index...), i)
+		ft := field.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		if ft.Kind() == reflect.Struct {
+			keys = appendKeys(keys, ft, prefix+name+".", fieldIndex)
+			continue
+		}
+		keys = append(keys, key{name: prefix + name, index: fieldIndex, isBool: ft.Kind() == reflect.Bool})
+	}
+	return keys
+}
+
+// set parses value into the leaf, allocating the optional sections on the way.
+func (k key) set(cfg *Config, value string) error {
+	v := reflect.ValueOf(cfg).Elem()
+	for _, i := range k.index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(i)
+	}
+	// yaml would take "#" as a comment and "null" as nothing, strings are kept as they are
+	if v.Kind() == reflect.String {
+		v.SetString(value)
+		return nil
+	}
+	if err := yaml.Unmarshal([]byte(value), v.Addr().Interface()); err != nil {
+		return fmt.Errorf("parse %s: %w", k.name, err)
+	}
+	return nil
+}
+
+// applyEnv sets the keys from the SPARKY_* variables. A variable of no key is an error
+// for the same reason an unknown key in the file is.
+func applyEnv(cfg *Config, keys []key, environ []string) error {
+	byEnv := make(map[string]key, len(keys))
+	for _, k := range keys {
+		byEnv[k.env()] = k
+	}
+	for _, kv := range environ {
+		name, value, _ := strings.Cut(kv, "=")
+		if !strings.HasPrefix(name, envPrefix) {
+			continue
+		}
+		k, ok := byEnv[name]
+		if !ok {
+			return fmt.Errorf("unknown config variable %s", name)
+		}
+		if err := k.set(cfg, value); err != nil {
+			return fmt.Errorf("variable %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// flagValue keeps the raw flag, flags are applied after the file and the environment.
+type flagValue struct {
+	value  string
+	isBool bool
+}
+
+// IsBoolFlag lets a bool be set by the flag alone, as -media.public_photos.
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+func (f *flagValue) String() string {
+	return f.value
+}
+
+func (f *flagValue) Set(value string) error {
+	f.value = value
+	return nil
+}
+
+func defineFlags(fs *flag.FlagSet, keys []key) map[string]*flagValue {
+	flags := make(map[string]*flagValue, len(keys))
+	for _, k := range keys {
+		f := &flagValue{isBool: k.isBool}
+		fs.Var(f, k.name, fmt.Sprintf("overrides %s, also set by %s", k.name, k.env()))
+		flags[k.name] = f
+	}
+	return flags
+}
+
+func applyFlags(cfg *Config, fs *flag.FlagSet, keys []key, flags map[string]*flagValue) error {
+	byName := make(map[string]key, len(keys))
+	for _, k := range keys {
+		byName[k.name] = k
+	}
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		k, ok := byName[f.Name]
+		if !ok || err != nil {
+			return
+		}
+		if setErr := k.set(cfg, flags[f.Name].value); setErr != nil {
+			err = fmt.Errorf("flag -%s: %w", f.Name, setErr)
+		}
+	})
+	return err
+}
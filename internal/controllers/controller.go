@@ -1,19 +1,33 @@
 package controllers
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/uptrace/bunrouter"
+	"io"
 	"net/http"
 	"sparky-back/internal/convert"
+	"sparky-back/internal/httperr"
 	"sparky-back/internal/logic"
+	"sparky-back/internal/metrics"
+	"sparky-back/pkg/urlsign"
 	"strconv"
+	"sync"
+	"time"
+)
+
+// upload kinds of the upload size metric
+const (
+	uploadPhoto      = "photo"
+	uploadAttachment = "attachment"
 )
 
 type Controller struct {
 	logic *logic.Logic
+	// webSockets counts the WebSocket handlers, http.Server.Shutdown does not wait for
+	// hijacked connections
+	webSockets sync.WaitGroup
 }
 
 func New(l *logic.Logic) *Controller {
@@ -31,7 +45,7 @@ func (c *Controller) AddUser(w http.ResponseWriter, req bunrouter.Request) error
 	if err != nil {
 		return fmt.Errorf("parsing post form: %w", err)
 	}
-	file, handler, err := req.FormFile("img")
+	file, header, err := req.FormFile("img")
 	if err != nil {
 		if errors.Is(err, http.ErrMissingFile) {
 			return fmt.Errorf("file img does not exist in the form: %w", err)
@@ -40,13 +54,8 @@ func (c *Controller) AddUser(w http.ResponseWriter, req bunrouter.Request) error
 		}
 	}
 	defer file.Close()
-	imageName := handler.Filename
-	imagePath, err := c.logic.SaveImg(file, imageName)
-	if err != nil {
-		return fmt.Errorf("saving image: %w", err)
-	}
-	user.ImgPath = imagePath
-	id, err := c.logic.AddUser(context.TODO(), user)
+	metrics.UploadSize.WithLabelValues(uploadPhoto).Observe(float64(header.Size))
+	id, err := c.logic.AddUser(req.Context(), user, file)
 	if err != nil {
 		return fmt.Errorf("adding user: %w", err)
 	}
@@ -63,21 +72,26 @@ func (c *Controller) UpdateUser(w http.ResponseWriter, req bunrouter.Request) er
 	if err != nil {
 		return fmt.Errorf("parsing post form: %w", err)
 	}
-	file, handler, err := req.FormFile("img")
+	file, header, err := req.FormFile("img")
 	if err != nil {
 		if !errors.Is(err, http.ErrMissingFile) {
 			return fmt.Errorf("getting form file img: %w", err)
 		}
 	} else {
 		defer file.Close()
-		imageName := handler.Filename
-		imagePath, err := c.logic.SaveImg(file, imageName)
+		metrics.UploadSize.WithLabelValues(uploadPhoto).Observe(float64(header.Size))
+		_, err = c.logic.ReplacePrimaryPhoto(req.Context(), user.ID, file)
 		if err != nil {
-			return fmt.Errorf("saving image: %w", err)
+			return fmt.Errorf("replacing primary photo: %w", err)
 		}
-		user.ImgPath = imagePath
 	}
-	id, err := c.logic.UpdateUser(context.TODO(), user)
+	if req.PostForm.Has("hide_presence") {
+		err = c.logic.SetPresenceHidden(req.Context(), user.ID, user.HidePresence)
+		if err != nil {
+			return fmt.Errorf("setting presence privacy: %w", err)
+		}
+	}
+	id, err := c.logic.UpdateUser(req.Context(), user)
 	if err != nil {
 		return fmt.Errorf("updating user: %w", err)
 	}
@@ -94,7 +108,7 @@ func (c *Controller) Login(w http.ResponseWriter, req bunrouter.Request) error {
 	if err != nil {
 		return fmt.Errorf("parsing post form: %w", err)
 	}
-	id, err := c.logic.LogIn(context.TODO(), user.Email, user.Password)
+	id, err := c.logic.LogIn(req.Context(), user.Email, user.Password)
 	if err != nil {
 		return fmt.Errorf("login: %w", err)
 	}
@@ -106,7 +120,7 @@ func (c *Controller) GetUser(w http.ResponseWriter, req bunrouter.Request) error
 	idStr := req.URL.Query().Get("id")
 	if idStr != "" {
 		id, err := strconv.ParseInt(idStr, 10, 64)
-		user, err := c.logic.GetUserByID(context.TODO(), id)
+		user, err := c.logic.GetUserByID(req.Context(), id)
 		if err != nil {
 			return fmt.Errorf("getting user: %w", err)
 		}
@@ -119,7 +133,7 @@ func (c *Controller) GetUser(w http.ResponseWriter, req bunrouter.Request) error
 	}
 	emailStr := req.URL.Query().Get("email")
 	if emailStr != "" {
-		user, err := c.logic.GetUserByEmail(context.TODO(), emailStr)
+		user, err := c.logic.GetUserByEmail(req.Context(), emailStr)
 		if err != nil {
 			return fmt.Errorf("getting user: %w", err)
 		}
@@ -131,6 +145,73 @@ func (c *Controller) GetUser(w http.ResponseWriter, req bunrouter.Request) error
 		return nil
 	}
 	return fmt.Errorf("no id or email param")
+}
+
+func (c *Controller) AddPhoto(w http.ResponseWriter, req bunrouter.Request) error {
+	err := req.ParseMultipartForm(1 << 22)
+	if err != nil {
+		return fmt.Errorf("big multipartform size: %w", err)
+	}
+	photo, err := convert.FormToPhoto(req.PostForm)
+	if err != nil {
+		return fmt.Errorf("parsing post form: %w", err)
+	}
+	file, header, err := req.FormFile("img")
+	if err != nil {
+		return fmt.Errorf("getting form file img: %w", err)
+	}
+	defer file.Close()
+	metrics.UploadSize.WithLabelValues(uploadPhoto).Observe(float64(header.Size))
+	photo, err = c.logic.AddPhoto(req.Context(), photo.UserID, file)
+	if err != nil {
+		return fmt.Errorf("adding photo: %w", err)
+	}
+	jsonData, err := json.Marshal(photo)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	w.Write(jsonData)
+	return nil
+}
+
+func (c *Controller) ReorderPhotos(w http.ResponseWriter, req bunrouter.Request) error {
+	err := req.ParseMultipartForm(1 << 22)
+	if err != nil {
+		return fmt.Errorf("big multipartform size: %w", err)
+	}
+	photo, err := convert.FormToPhoto(req.PostForm)
+	if err != nil {
+		return fmt.Errorf("parsing post form: %w", err)
+	}
+	ids, err := convert.FormToPhotoOrder(req.PostForm)
+	if err != nil {
+		return fmt.Errorf("parsing post form: %w", err)
+	}
+	photos, err := c.logic.ReorderPhotos(req.Context(), photo.UserID, ids)
+	if err != nil {
+		return fmt.Errorf("reordering photos: %w", err)
+	}
+	jsonData, err := json.Marshal(photos)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	w.Write(jsonData)
+	return nil
+}
+
+func (c *Controller) DeletePhoto(w http.ResponseWriter, req bunrouter.Request) error {
+	err := req.ParseMultipartForm(1 << 22)
+	if err != nil {
+		return fmt.Errorf("big multipartform size: %w", err)
+	}
+	photo, err := convert.FormToPhoto(req.PostForm)
+	if err != nil {
+		return fmt.Errorf("parsing post form: %w", err)
+	}
+	err = c.logic.DeletePhoto(req.Context(), photo.UserID, photo.ID)
+	if err != nil {
+		return fmt.Errorf("deleting photo: %w", err)
+	}
 	return nil
 }
 
@@ -139,11 +220,71 @@ func (c *Controller) GetFile(w http.ResponseWriter, req bunrouter.Request) error
 	if !ok {
 		return fmt.Errorf("no filename param")
 	}
-	data, err := c.logic.GetFile(filename)
+	query := req.URL.Query()
+	file, expiresAt, err := c.logic.OpenFile(req.Context(), filename, query.Get(urlsign.ExpiresParam), query.Get(urlsign.SignatureParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, logic.ErrFileNotFound):
+			return httperr.New(http.StatusNotFound, fmt.Errorf("getting file: %w", err))
+		case errors.Is(err, logic.ErrFileForbidden):
+			return httperr.New(http.StatusForbidden, fmt.Errorf("getting file: %w", err))
+		default:
+			return httperr.New(http.StatusInternalServerError, fmt.Errorf("getting file: %w", err))
+		}
+	}
+	defer file.Close()
+
+	// a key always refers to the same content, new uploads get new keys
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("ETag", `"`+file.Key+`"`)
+	if expiresAt.IsZero() {
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		maxAge := int(time.Until(expiresAt).Seconds())
+		w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d, immutable", maxAge))
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, req.Request, file.Key, file.ModTime, file)
+	return nil
+}
+
+func (c *Controller) GetAttachment(w http.ResponseWriter, req bunrouter.Request) error {
+	id, err := req.Params().Int64("id")
 	if err != nil {
-		return fmt.Errorf("getting file: %w", err)
+		return fmt.Errorf("parsing id param: %w", err)
+	}
+	query := req.URL.Query()
+	userID, err := strconv.ParseInt(query.Get("user_id"), 10, 64)
+	if err != nil {
+		return fmt.Errorf("parsing user_id param: %w", err)
+	}
+	var size int
+	if sizeStr := query.Get("size"); sizeStr != "" {
+		size, err = strconv.Atoi(sizeStr)
+		if err != nil {
+			return fmt.Errorf("parsing size param: %w", err)
+		}
+	}
+	file, expiresAt, err := c.logic.OpenAttachment(req.Context(), userID, id, size, query.Get(urlsign.ExpiresParam), query.Get(urlsign.SignatureParam))
+	if err != nil {
+		switch {
+		case errors.Is(err, logic.ErrFileNotFound):
+			return httperr.New(http.StatusNotFound, fmt.Errorf("getting attachment: %w", err))
+		case errors.Is(err, logic.ErrFileForbidden):
+			return httperr.New(http.StatusForbidden, fmt.Errorf("getting attachment: %w", err))
+		default:
+			return httperr.New(http.StatusInternalServerError, fmt.Errorf("getting attachment: %w", err))
+		}
 	}
-	w.Write(data)
+	defer file.Close()
+
+	// the url is signed for one user, so only the user's own cache may keep it
+	maxAge := int(time.Until(expiresAt).Seconds())
+	w.Header().Set("Content-Type", file.ContentType)
+	w.Header().Set("ETag", `"`+file.Key+`"`)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", maxAge))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	http.ServeContent(w, req.Request, file.Key, file.ModTime, file)
 	return nil
 }
 
@@ -156,14 +297,14 @@ func (c *Controller) SetReaction(w http.ResponseWriter, req bunrouter.Request) e
 	if err != nil {
 		return fmt.Errorf("parsing post form: %w", err)
 	}
-	err = c.logic.SetReaction(context.TODO(), reaction)
+	err = c.logic.SetReaction(req.Context(), reaction)
 	if err != nil {
 		return fmt.Errorf("setting reaction: %w", err)
 	}
 	return nil
 }
 
-func (c *Controller) ClientConnection(w http.ResponseWriter, req bunrouter.Request) error {
+func (c *Controller) NewMessage(w http.ResponseWriter, req bunrouter.Request) error {
 	err := req.ParseMultipartForm(1 << 22)
 	if err != nil {
 		return fmt.Errorf("big multipartform size: %w", err)
@@ -172,30 +313,86 @@ func (c *Controller) ClientConnection(w http.ResponseWriter, req bunrouter.Reque
 	if err != nil {
 		return fmt.Errorf("parsing post form: %w", err)
 	}
+	headers := req.MultipartForm.File["attachment"]
+	files := make([]io.Reader, 0, len(headers))
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			return fmt.Errorf("opening form file attachment: %w", err)
+		}
+		defer file.Close()
+		metrics.UploadSize.WithLabelValues(uploadAttachment).Observe(float64(header.Size))
+		files = append(files, file)
+	}
+	err = c.logic.NewMessage(req.Context(), msg, files...)
+	if err != nil {
+		return fmt.Errorf("sending message: %w", err)
+	}
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	w.Write(jsonData)
+	return nil
+}
 
-	//TODO it's sse((
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		return fmt.Errorf("streaming unsupported: %w", err)
+func (c *Controller) Typing(w http.ResponseWriter, req bunrouter.Request) error {
+	err := req.ParseMultipartForm(1 << 22)
+	if err != nil {
+		return fmt.Errorf("big multipartform size: %w", err)
 	}
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
+	msg, err := convert.FormToMessage(req.PostForm)
+	if err != nil {
+		return fmt.Errorf("parsing post form: %w", err)
+	}
+	err = c.logic.Typing(req.Context(), msg.UserID, msg.ToID)
+	if errors.Is(err, logic.ErrNotMatched) {
+		return httperr.New(http.StatusForbidden, fmt.Errorf("typing: %w", err))
+	}
+	if err != nil {
+		return fmt.Errorf("typing: %w", err)
+	}
+	return nil
+}
 
-	sse := func(data []byte) {
-		fmt.Fprintf(w, "data: %s\n\n", string(data))
-		flusher.Flush()
+func (c *Controller) MarkRead(w http.ResponseWriter, req bunrouter.Request) error {
+	err := req.ParseMultipartForm(1 << 22)
+	if err != nil {
+		return fmt.Errorf("big multipartform size: %w", err)
 	}
-	err = c.logic.SendMessages(req.Context(), sse, msg)
+	msg, err := convert.FormToMessage(req.PostForm)
+	if err != nil {
+		return fmt.Errorf("parsing post form: %w", err)
+	}
+	err = c.logic.MarkRead(req.Context(), msg.UserID, msg.ToID, msg.MessageID)
 	if err != nil {
-		return fmt.Errorf("sending messages: %w", err)
+		return fmt.Errorf("marking read: %w", err)
 	}
+	return nil
+}
 
-	<-req.Context().Done()
+func (c *Controller) EditMessage(w http.ResponseWriter, req bunrouter.Request) error {
+	err := req.ParseMultipartForm(1 << 22)
+	if err != nil {
+		return fmt.Errorf("big multipartform size: %w", err)
+	}
+	msg, err := convert.FormToMessage(req.PostForm)
+	if err != nil {
+		return fmt.Errorf("parsing post form: %w", err)
+	}
+	msg, err = c.logic.EditMessage(req.Context(), msg.UserID, msg.MessageID, msg.Text)
+	if err != nil {
+		return messageError("editing message", err)
+	}
+	jsonData, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	w.Write(jsonData)
 	return nil
 }
 
-func (c *Controller) NewMessage(w http.ResponseWriter, req bunrouter.Request) error {
+func (c *Controller) DeleteMessage(w http.ResponseWriter, req bunrouter.Request) error {
 	err := req.ParseMultipartForm(1 << 22)
 	if err != nil {
 		return fmt.Errorf("big multipartform size: %w", err)
@@ -204,7 +401,77 @@ func (c *Controller) NewMessage(w http.ResponseWriter, req bunrouter.Request) er
 	if err != nil {
 		return fmt.Errorf("parsing post form: %w", err)
 	}
-	return c.logic.NewMessage(msg)
+	_, err = c.logic.DeleteMessage(req.Context(), msg.UserID, msg.MessageID)
+	if err != nil {
+		return messageError("deleting message", err)
+	}
+	return nil
+}
+
+func messageError(action string, err error) error {
+	switch {
+	case errors.Is(err, logic.ErrMessageNotFound):
+		return httperr.New(http.StatusNotFound, fmt.Errorf("%s: %w", action, err))
+	case errors.Is(err, logic.ErrMessageDeleted), errors.Is(err, logic.ErrEditWindow):
+		return httperr.New(http.StatusConflict, fmt.Errorf("%s: %w", action, err))
+	default:
+		return fmt.Errorf("%s: %w", action, err)
+	}
+}
+
+func (c *Controller) GetConversations(w http.ResponseWriter, req bunrouter.Request) error {
+	page, err := convert.FormToPage(req.URL.Query())
+	if err != nil {
+		return fmt.Errorf("parsing query: %w", err)
+	}
+	conversations, err := c.logic.GetConversations(req.Context(), page.UserID)
+	if err != nil {
+		return fmt.Errorf("getting conversations: %w", err)
+	}
+	jsonData, err := json.Marshal(conversations)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	w.Write(jsonData)
+	return nil
+}
+
+func (c *Controller) GetConversationMessages(w http.ResponseWriter, req bunrouter.Request) error {
+	page, err := convert.FormToPage(req.URL.Query())
+	if err != nil {
+		return fmt.Errorf("parsing query: %w", err)
+	}
+	page.PartnerID, err = req.Params().Int64("id")
+	if err != nil {
+		return fmt.Errorf("parsing id param: %w", err)
+	}
+	messages, err := c.logic.GetConversationMessages(req.Context(), page)
+	if err != nil {
+		return fmt.Errorf("getting messages: %w", err)
+	}
+	jsonData, err := json.Marshal(messages)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	w.Write(jsonData)
+	return nil
+}
+
+func (c *Controller) SearchMessages(w http.ResponseWriter, req bunrouter.Request) error {
+	search, err := convert.FormToSearch(req.URL.Query())
+	if err != nil {
+		return fmt.Errorf("parsing query: %w", err)
+	}
+	results, err := c.logic.SearchMessages(req.Context(), search)
+	if err != nil {
+		return fmt.Errorf("searching messages: %w", err)
+	}
+	jsonData, err := json.Marshal(results)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	w.Write(jsonData)
+	return nil
 }
 
 func (c *Controller) GetRecommendations(w http.ResponseWriter, req bunrouter.Request) error {
@@ -216,7 +483,7 @@ func (c *Controller) GetRecommendations(w http.ResponseWriter, req bunrouter.Req
 	if err != nil {
 		return fmt.Errorf("parsing post form: %w", err)
 	}
-	users, err := c.logic.GetRecommendations(context.TODO(), filter)
+	users, err := c.logic.GetRecommendations(req.Context(), filter)
 	if err != nil {
 		return fmt.Errorf("getting recomendations: %w", err)
 	}
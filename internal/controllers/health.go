@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"sparky-back/internal/health"
+)
+
+type Health struct {
+	checker *health.Checker
+}
+
+func NewHealth(checker *health.Checker) *Health {
+	return &Health{
+		checker: checker,
+	}
+}
+
+// Liveness only shows that the process serves requests, dependencies are checked by Readiness.
+func (h *Health) Liveness(w http.ResponseWriter, req bunrouter.Request) error {
+	jsonData, err := json.Marshal(health.Result{Status: health.StatusOK})
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	w.Write(jsonData)
+	return nil
+}
+
+func (h *Health) Readiness(w http.ResponseWriter, req bunrouter.Request) error {
+	report := h.checker.Ready(req.Context())
+	jsonData, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	if !report.OK() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	w.Write(jsonData)
+	return nil
+}
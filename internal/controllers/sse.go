@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"sparky-back/internal/convert"
+	"sparky-back/internal/logic"
+	"sparky-back/internal/models"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	sseHeartbeatPeriod = 15 * time.Second
+	lastEventIDHeader  = "Last-Event-ID"
+	lastEventIDParam   = "last_event_id"
+)
+
+// ClientConnection is the server-sent events stream of the chat. Events carry their type in
+// the event field, messages carry their id in the id field, so a reconnecting client
+// gets exactly the messages it missed.
+func (c *Controller) ClientConnection(w http.ResponseWriter, req bunrouter.Request) error {
+	// EventSource can only GET, older clients POST a form
+	err := req.ParseMultipartForm(1 << 22)
+	if err != nil && !errors.Is(err, http.ErrNotMultipart) {
+		return fmt.Errorf("big multipartform size: %w", err)
+	}
+	msg, err := convert.FormToMessage(req.Form)
+	if err != nil {
+		return fmt.Errorf("parsing form: %w", err)
+	}
+	msg.MessageID, err = lastEventID(req.Request)
+	if err != nil {
+		return err
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return fmt.Errorf("streaming unsupported")
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	var mu sync.Mutex
+	sse := func(event models.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		if err := writeEvent(w, event); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	// comments keep proxies from closing an idle stream, the heartbeat ends before the handler
+	// returns, the writer must not be used after that
+	stopHeartbeat := make(chan struct{})
+	var heartbeat sync.WaitGroup
+	heartbeat.Add(1)
+	defer func() {
+		close(stopHeartbeat)
+		heartbeat.Wait()
+	}()
+	go func() {
+		defer heartbeat.Done()
+		ticker := time.NewTicker(sseHeartbeatPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mu.Lock()
+				_, err := fmt.Fprint(w, ": heartbeat\n\n")
+				if err == nil {
+					flusher.Flush()
+				}
+				mu.Unlock()
+			case <-stopHeartbeat:
+				return
+			}
+		}
+	}()
+
+	err = c.logic.SendMessages(req.Context(), sse, msg)
+	if errors.Is(err, logic.ErrGoingAway) {
+		return nil
+	}
+	if err != nil && req.Context().Err() == nil {
+		return fmt.Errorf("sending messages: %w", err)
+	}
+	return nil
+}
+
+// writeEvent writes one SSE event. Messages are sent as is, other events as a whole.
+func writeEvent(w http.ResponseWriter, event models.Event) error {
+	var payload any = event
+	if event.Message != nil && (event.Type == models.EventMessage || event.Type == models.EventMatch) {
+		payload = event.Message
+		if _, err := fmt.Fprintf(w, "id: %d\n", event.Message.MessageID); err != nil {
+			return err
+		}
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshaling json: %w", err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+	return err
+}
+
+// lastEventID is the id of the last message the client got. Browsers send the header
+// on reconnect, the param lets a client resume on its first connection.
+func lastEventID(req *http.Request) (int64, error) {
+	idStr := req.Header.Get(lastEventIDHeader)
+	if idStr == "" {
+		idStr = req.URL.Query().Get(lastEventIDParam)
+	}
+	if idStr == "" {
+		return 0, nil
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("parse last event id: %w", err)
+	}
+	return id, nil
+}
@@ -0,0 +1,84 @@
+package controllers
+
+import (
+	"net/http/httptest"
+	"sparky-back/internal/models"
+	"testing"
+)
+
+func TestWriteEvent(t *testing.T) {
+	tests := []struct {
+		name  string
+		event models.Event
+		want  string
+	}{
+		{
+			name: "message",
+			event: models.Event{
+				Type:    models.EventMessage,
+				Message: &models.Message{MessageID: 12, UserID: 1, ToID: 2, Text: "hi"},
+			},
+			want: "id: 12\nevent: message\ndata: {\"id\":12,\"user_id\":1,\"to_id\":2,",
+		},
+		{
+			name:  "typing",
+			event: models.Event{Type: models.EventTyping, UserID: 1},
+			want:  "event: typing\ndata: {\"type\":\"typing\",\"user_id\":1}\n\n",
+		},
+		{
+			name: "edit",
+			event: models.Event{
+				Type:      models.EventEdit,
+				MessageID: 12,
+				Message:   &models.Message{MessageID: 12},
+			},
+			want: "event: edit\ndata: {\"type\":\"edit\",\"message_id\":12,\"message\":",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			if err := writeEvent(rec, tt.event); err != nil {
+				t.Fatal(err)
+			}
+			got := rec.Body.String()
+			if len(got) < len(tt.want) || got[:len(tt.want)] != tt.want {
+				t.Errorf("got %q, want it to start with %q", got, tt.want)
+			}
+			if got[len(got)-2:] != "\n\n" {
+				t.Errorf("got %q, want it to end with a blank line", got)
+			}
+		})
+	}
+}
+
+func TestLastEventID(t *testing.T) {
+	tests := []struct {
+		name    string
+		header  string
+		query   string
+		want    int64
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "header", header: "12", want: 12},
+		{name: "query", query: "?last_event_id=7", want: 7},
+		{name: "header first", header: "12", query: "?last_event_id=7", want: 12},
+		{name: "invalid", header: "abc", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/connection"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set(lastEventIDHeader, tt.header)
+			}
+			got, err := lastEventID(req)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,162 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/websocket"
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"sparky-back/internal/convert"
+	"sparky-back/internal/logic"
+	"sparky-back/internal/models"
+	"sync"
+	"time"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = wsPongWait * 9 / 10
+	wsMaxMessage = 1 << 16
+	// wsEventTimeout bounds handling a client event, which is not canceled with the connection
+	wsEventTimeout = 10 * time.Second
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// the api has no cookies, so cross-origin connections are not dangerous
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// WebSocket is the two-way chat connection. The client sends message, typing, read, edit and delete events,
+// gets an ack for every message it sent and all the events SSE clients get.
+func (c *Controller) WebSocket(w http.ResponseWriter, req bunrouter.Request) error {
+	msg, err := convert.FormToMessage(req.URL.Query())
+	if err != nil {
+		return fmt.Errorf("parsing query: %w", err)
+	}
+	msg.MessageID, err = lastEventID(req.Request)
+	if err != nil {
+		return err
+	}
+	// counted before the upgrade, while Shutdown still waits for the request
+	c.webSockets.Add(1)
+	defer c.webSockets.Done()
+	conn, err := upgrader.Upgrade(w, req.Request, nil)
+	if err != nil {
+		// Upgrade has already answered the client
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	defer cancel()
+
+	var mu sync.Mutex
+	send := func(event models.Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+		return conn.WriteJSON(event)
+	}
+
+	readDone := make(chan struct{})
+	go func() {
+		defer close(readDone)
+		defer cancel()
+		c.readEvents(ctx, conn, msg.UserID, send)
+	}()
+	// closing the connection ends the reader, the event it is handling is finished first
+	defer func() {
+		conn.Close()
+		<-readDone
+	}()
+	go func() {
+		ticker := time.NewTicker(wsPingPeriod)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+					cancel()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	err = c.logic.SendMessages(ctx, send, msg)
+	if errors.Is(err, logic.ErrGoingAway) {
+		mu.Lock()
+		defer mu.Unlock()
+		closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, err.Error())
+		conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(wsWriteWait))
+		return nil
+	}
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("sending messages: %w", err)
+	}
+	return nil
+}
+
+// readEvents handles client events until the connection breaks.
+func (c *Controller) readEvents(ctx context.Context, conn *websocket.Conn, userID int64, send func(models.Event) error) {
+	conn.SetReadLimit(wsMaxMessage)
+	conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var (
+			event models.Event
+			reply *models.Event
+		)
+		err = json.Unmarshal(data, &event)
+		if err == nil {
+			reply, err = c.handleEvent(ctx, userID, event)
+		}
+		if err != nil {
+			reply = &models.Event{
+				Type:  models.EventError,
+				Error: err.Error(),
+			}
+		}
+		if reply == nil {
+			continue
+		}
+		if err = send(*reply); err != nil {
+			return
+		}
+	}
+}
+
+// handleEvent does not stop when the connection closes, a message being saved is saved.
+func (c *Controller) handleEvent(ctx context.Context, userID int64, event models.Event) (*models.Event, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), wsEventTimeout)
+	defer cancel()
+	return c.logic.HandleEvent(ctx, userID, event)
+}
+
+// WaitWebSockets waits until the WebSocket handlers return or ctx is done.
+// The hub must be closed first, live connections do not end by themselves.
+func (c *Controller) WaitWebSockets(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		c.webSockets.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
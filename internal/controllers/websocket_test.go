@@ -0,0 +1,24 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestController_WaitWebSockets(t *testing.T) {
+	c := &Controller{}
+	c.webSockets.Add(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.WaitWebSockets(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got %v with a live connection, want the deadline", err)
+	}
+
+	c.webSockets.Done()
+	if err := c.WaitWebSockets(context.Background()); err != nil {
+		t.Errorf("got %v, want nil after the connection ended", err)
+	}
+}
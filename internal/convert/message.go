@@ -8,12 +8,23 @@ import (
 	"time"
 )
 
-const timeLayout = "2006-01-02 15:04:05"
+const (
+	timeLayout     = "2006-01-02 15:04:05"
+	maxClientIDLen = 64
+)
 
 func FormToMessage(form url.Values) (*models.Message, error) {
 	message := new(models.Message)
 	var err error
 
+	id := form.Get("id")
+	if id != "" {
+		message.MessageID, err = strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse id field: %w", err)
+		}
+	}
+
 	userID := form.Get("user_id")
 	if userID != "" {
 		message.UserID, err = strconv.ParseInt(userID, 10, 64)
@@ -41,6 +52,11 @@ func FormToMessage(form url.Values) (*models.Message, error) {
 		message.Time = time.Now()
 	}
 
+	message.ClientID = form.Get("client_id")
+	if len(message.ClientID) > maxClientIDLen {
+		return nil, fmt.Errorf("client_id field is longer than %d bytes", maxClientIDLen)
+	}
+
 	message.Text = form.Get("text")
 
 	return message, nil
@@ -0,0 +1,47 @@
+package convert
+
+import (
+	"fmt"
+	"net/url"
+	"sparky-back/internal/models"
+	"strconv"
+)
+
+func FormToPage(form url.Values) (*models.Page, error) {
+	page := new(models.Page)
+	var err error
+
+	userID := form.Get("user_id")
+	if userID != "" {
+		page.UserID, err = strconv.ParseInt(userID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse user_id field: %w", err)
+		}
+	}
+
+	before := form.Get("before")
+	if before != "" {
+		page.Before, err = strconv.ParseInt(before, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse before field: %w", err)
+		}
+	}
+
+	after := form.Get("after")
+	if after != "" {
+		page.After, err = strconv.ParseInt(after, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse after field: %w", err)
+		}
+	}
+
+	limit := form.Get("limit")
+	if limit != "" {
+		page.Limit, err = strconv.Atoi(limit)
+		if err != nil {
+			return nil, fmt.Errorf("parse limit field: %w", err)
+		}
+	}
+
+	return page, nil
+}
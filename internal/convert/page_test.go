@@ -0,0 +1,38 @@
+package convert
+
+import (
+	"net/url"
+	"sparky-back/internal/models"
+	"testing"
+)
+
+func TestFormToPage(t *testing.T) {
+	tests := []struct {
+		name    string
+		form    url.Values
+		want    models.Page
+		wantErr bool
+	}{
+		{name: "empty", form: url.Values{}},
+		{
+			name: "all",
+			form: url.Values{"user_id": {"1"}, "before": {"20"}, "after": {"10"}, "limit": {"50"}},
+			want: models.Page{UserID: 1, Before: 20, After: 10, Limit: 50},
+		},
+		{name: "bad user_id", form: url.Values{"user_id": {"x"}}, wantErr: true},
+		{name: "bad before", form: url.Values{"before": {"x"}}, wantErr: true},
+		{name: "bad after", form: url.Values{"after": {"1.5"}}, wantErr: true},
+		{name: "bad limit", form: url.Values{"limit": {"x"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormToPage(tt.form)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %v", err, tt.wantErr)
+			}
+			if err == nil && *got != tt.want {
+				t.Errorf("got %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package convert
+
+import (
+	"fmt"
+	"net/url"
+	"sparky-back/internal/models"
+	"strconv"
+	"strings"
+)
+
+func FormToPhoto(form url.Values) (*models.Photo, error) {
+	photo := new(models.Photo)
+	var err error
+
+	id := form.Get("id")
+	if id != "" {
+		photo.ID, err = strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse id field: %w", err)
+		}
+	}
+
+	userID := form.Get("user_id")
+	if userID != "" {
+		photo.UserID, err = strconv.ParseInt(userID, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse user_id field: %w", err)
+		}
+	}
+
+	return photo, nil
+}
+
+// FormToPhotoOrder parses the comma separated photo ids of the ids field.
+func FormToPhotoOrder(form url.Values) ([]int64, error) {
+	idsStr := form.Get("ids")
+	if idsStr == "" {
+		return nil, fmt.Errorf("no ids field")
+	}
+	parts := strings.Split(idsStr, ",")
+	ids := make([]int64, 0, len(parts))
+	for _, part := range parts {
+		id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parse ids field: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
@@ -0,0 +1,32 @@
+package convert
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+)
+
+func TestFormToPhotoOrder(t *testing.T) {
+	tests := []struct {
+		ids     string
+		want    []int64
+		wantErr bool
+	}{
+		{ids: "3,1,2", want: []int64{3, 1, 2}},
+		{ids: " 3, 1 ,2 ", want: []int64{3, 1, 2}},
+		{ids: "7", want: []int64{7}},
+		{ids: "", wantErr: true},
+		{ids: "3,,2", wantErr: true},
+		{ids: "3,a", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := FormToPhotoOrder(url.Values{"ids": {tt.ids}})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FormToPhotoOrder(%q) error = %v, want error %v", tt.ids, err, tt.wantErr)
+			continue
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("FormToPhotoOrder(%q) = %v, want %v", tt.ids, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package convert
+
+import (
+	"fmt"
+	"net/url"
+	"sparky-back/internal/models"
+)
+
+func FormToSearch(form url.Values) (*models.SearchQuery, error) {
+	page, err := FormToPage(form)
+	if err != nil {
+		return nil, err
+	}
+	search := &models.SearchQuery{
+		UserID: page.UserID,
+		Query:  form.Get("q"),
+		Before: page.Before,
+		Limit:  page.Limit,
+	}
+	if search.Query == "" {
+		return nil, fmt.Errorf("no q field")
+	}
+	return search, nil
+}
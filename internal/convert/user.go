@@ -59,5 +59,13 @@ func FormToUser(form url.Values) (*models.User, error) {
 		}
 	}
 
+	hidePresence := form.Get("hide_presence")
+	if hidePresence != "" {
+		user.HidePresence, err = strconv.ParseBool(hidePresence)
+		if err != nil {
+			return nil, fmt.Errorf("parse hide_presence field: %w", err)
+		}
+	}
+
 	return user, nil
 }
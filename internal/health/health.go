@@ -0,0 +1,99 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+
+	checkTimeout = 2 * time.Second
+	shutdownName = "shutdown"
+)
+
+var ErrShuttingDown = errors.New("server is shutting down")
+
+// Check reports why a dependency can not be used, nil if it can.
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Report is the readiness of the server with a result for every check.
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+func (r *Report) OK() bool {
+	return r.Status == StatusOK
+}
+
+// Checker runs the readiness checks. Checks are added at startup, before the server is started.
+type Checker struct {
+	checks       map[string]Check
+	shuttingDown atomic.Bool
+}
+
+func New() *Checker {
+	return &Checker{
+		checks: make(map[string]Check),
+	}
+}
+
+func (c *Checker) Add(name string, check Check) {
+	c.checks[name] = check
+}
+
+// SetShuttingDown makes the server not ready, so no new requests are routed to it.
+func (c *Checker) SetShuttingDown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready runs all checks at once, each one is limited by checkTimeout.
+func (c *Checker) Ready(ctx context.Context) *Report {
+	report := &Report{
+		Status: StatusOK,
+		Checks: make(map[string]Result, len(c.checks)+1),
+	}
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+	for name, check := range c.checks {
+		wg.Add(1)
+		go func(name string, check Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+			err := check(ctx)
+			mu.Lock()
+			defer mu.Unlock()
+			report.add(name, err)
+		}(name, check)
+	}
+	wg.Wait()
+	if c.shuttingDown.Load() {
+		report.add(shutdownName, ErrShuttingDown)
+	}
+	return report
+}
+
+func (r *Report) add(name string, err error) {
+	if err == nil {
+		r.Checks[name] = Result{Status: StatusOK}
+		return
+	}
+	r.Status = StatusFail
+	r.Checks[name] = Result{
+		Status: StatusFail,
+		Error:  err.Error(),
+	}
+}
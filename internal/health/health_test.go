@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestChecker_Ready(t *testing.T) {
+	c := New()
+	c.Add("database", func(ctx context.Context) error { return nil })
+	c.Add("storage", func(ctx context.Context) error { return errors.New("read-only file system") })
+
+	report := c.Ready(context.Background())
+
+	if report.OK() {
+		t.Fatal("report is ok with a failed check")
+	}
+	if got := report.Checks["database"]; got.Status != StatusOK {
+		t.Errorf("database: got %+v, want ok", got)
+	}
+	if got := report.Checks["storage"]; got.Status != StatusFail || got.Error != "read-only file system" {
+		t.Errorf("storage: got %+v, want the error", got)
+	}
+}
+
+func TestChecker_ShuttingDown(t *testing.T) {
+	c := New()
+	c.Add("database", func(ctx context.Context) error { return nil })
+	if report := c.Ready(context.Background()); !report.OK() {
+		t.Fatalf("got %+v, want ok", report)
+	}
+
+	c.SetShuttingDown()
+
+	report := c.Ready(context.Background())
+	if report.OK() {
+		t.Fatal("report is ok while shutting down")
+	}
+	if got := report.Checks[shutdownName]; got.Status != StatusFail {
+		t.Errorf("shutdown: got %+v, want fail", got)
+	}
+}
@@ -0,0 +1,35 @@
+package httperr
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error is returned by handlers to answer with a specific status instead of 400 Bad Request.
+type Error struct {
+	Status int
+	Err    error
+}
+
+func New(status int, err error) error {
+	return &Error{
+		Status: status,
+		Err:    err,
+	}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func Status(err error) int {
+	var httpErr *Error
+	if errors.As(err, &httpErr) {
+		return httpErr.Status
+	}
+	return http.StatusBadRequest
+}
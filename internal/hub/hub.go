@@ -0,0 +1,152 @@
+package hub
+
+import (
+	"sparky-back/internal/models"
+	"sync"
+	"sync/atomic"
+)
+
+// Policy decides what happens to a subscriber whose buffer is full.
+type Policy int
+
+const (
+	// Drop loses the event, the subscriber keeps getting the next ones.
+	Drop Policy = iota
+	// Disconnect closes the subscriber, the client is expected to reconnect and catch up.
+	Disconnect
+)
+
+// Hub fans events out to every live connection of a user. Publish never blocks,
+// a slow subscriber is handled according to its policy.
+type Hub struct {
+	mu        sync.RWMutex
+	subs      map[int64]map[*Subscriber]struct{}
+	bufSize   int
+	dropped   atomic.Int64
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func New(bufSize int) *Hub {
+	return &Hub{
+		subs:    make(map[int64]map[*Subscriber]struct{}),
+		bufSize: bufSize,
+		closed:  make(chan struct{}),
+	}
+}
+
+type Subscriber struct {
+	UserID    int64
+	policy    Policy
+	events    chan models.Event
+	done      chan struct{}
+	closeOnce sync.Once
+	dropped   atomic.Int64
+}
+
+// Events is never closed, wait on Done as well.
+func (s *Subscriber) Events() <-chan models.Event {
+	return s.events
+}
+
+// Done is closed when the subscriber is unsubscribed or disconnected by its policy.
+func (s *Subscriber) Done() <-chan struct{} {
+	return s.done
+}
+
+// Dropped is the number of events the subscriber has lost.
+func (s *Subscriber) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+func (s *Subscriber) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+func (h *Hub) Subscribe(userID int64, policy Policy) *Subscriber {
+	s := &Subscriber{
+		UserID: userID,
+		policy: policy,
+		events: make(chan models.Event, h.bufSize),
+		done:   make(chan struct{}),
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[*Subscriber]struct{})
+	}
+	h.subs[userID][s] = struct{}{}
+	return s
+}
+
+// Unsubscribe is safe to call more than once.
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mu.Lock()
+	if subs, ok := h.subs[s.UserID]; ok {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(h.subs, s.UserID)
+		}
+	}
+	h.mu.Unlock()
+	s.close()
+}
+
+func (h *Hub) Publish(userID int64, event models.Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subs[userID] {
+		select {
+		case <-s.done:
+			continue
+		default:
+		}
+		select {
+		case s.events <- event:
+		default:
+			s.dropped.Add(1)
+			h.dropped.Add(1)
+			if s.policy == Disconnect {
+				s.close()
+			}
+		}
+	}
+}
+
+// Connections is the number of live subscribers of the user.
+func (h *Hub) Connections(userID int64) int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.subs[userID])
+}
+
+// Count is the number of live subscribers of all users.
+func (h *Hub) Count() int {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	count := 0
+	for _, subs := range h.subs {
+		count += len(subs)
+	}
+	return count
+}
+
+// Dropped is the number of events lost by all subscribers so far.
+func (h *Hub) Dropped() int64 {
+	return h.dropped.Load()
+}
+
+// Close tells the subscribers the server is going away, they should end their connections.
+// It is safe to call more than once.
+func (h *Hub) Close() {
+	h.closeOnce.Do(func() {
+		close(h.closed)
+	})
+}
+
+// Closed is closed by Close.
+func (h *Hub) Closed() <-chan struct{} {
+	return h.closed
+}
@@ -0,0 +1,179 @@
+package hub
+
+import (
+	"sparky-back/internal/models"
+	"sync"
+	"testing"
+	"time"
+)
+
+func event(id int64) models.Event {
+	return models.Event{
+		Type:      models.EventMessage,
+		MessageID: id,
+	}
+}
+
+func TestHub_FanOut(t *testing.T) {
+	h := New(10)
+	phone := h.Subscribe(1, Drop)
+	laptop := h.Subscribe(1, Drop)
+	other := h.Subscribe(2, Drop)
+
+	h.Publish(1, event(7))
+
+	for _, s := range []*Subscriber{phone, laptop} {
+		select {
+		case got := <-s.Events():
+			if got.MessageID != 7 {
+				t.Errorf("got message %d, want 7", got.MessageID)
+			}
+		default:
+			t.Error("subscriber did not get the event")
+		}
+	}
+	select {
+	case got := <-other.Events():
+		t.Errorf("other user got %+v", got)
+	default:
+	}
+	if n := h.Connections(1); n != 2 {
+		t.Errorf("got %d connections, want 2", n)
+	}
+}
+
+func TestHub_Unsubscribe(t *testing.T) {
+	h := New(10)
+	s := h.Subscribe(1, Drop)
+	h.Unsubscribe(s)
+	h.Unsubscribe(s)
+
+	h.Publish(1, event(1))
+
+	select {
+	case <-s.Done():
+	default:
+		t.Error("done is not closed")
+	}
+	if len(s.Events()) != 0 {
+		t.Error("unsubscribed subscriber got an event")
+	}
+	if n := h.Count(); n != 0 {
+		t.Errorf("got %d connections, want 0", n)
+	}
+}
+
+func TestHub_DropPolicy(t *testing.T) {
+	h := New(2)
+	s := h.Subscribe(1, Drop)
+	for i := int64(1); i <= 5; i++ {
+		h.Publish(1, event(i))
+	}
+	if got := s.Dropped(); got != 3 {
+		t.Errorf("got %d dropped, want 3", got)
+	}
+	if got := (<-s.Events()).MessageID; got != 1 {
+		t.Errorf("got message %d, want the oldest one", got)
+	}
+	select {
+	case <-s.Done():
+		t.Error("drop policy disconnected the subscriber")
+	default:
+	}
+}
+
+func TestHub_DisconnectPolicy(t *testing.T) {
+	h := New(1)
+	slow := h.Subscribe(1, Disconnect)
+	fast := h.Subscribe(1, Disconnect)
+	h.Publish(1, event(1))
+	<-fast.Events()
+	h.Publish(1, event(2))
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Error("slow subscriber is not disconnected")
+	}
+	select {
+	case <-fast.Done():
+		t.Error("fast subscriber is disconnected")
+	default:
+	}
+	if got := h.Dropped(); got != 1 {
+		t.Errorf("got %d dropped, want 1", got)
+	}
+}
+
+// TestHub_Concurrent is meant for go test -race.
+func TestHub_Concurrent(t *testing.T) {
+	h := New(4)
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+
+	for user := int64(1); user <= 4; user++ {
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func(user int64, policy Policy) {
+				defer wg.Done()
+				for {
+					s := h.Subscribe(user, policy)
+					timer := time.NewTimer(time.Millisecond)
+				read:
+					for {
+						select {
+						case <-s.Events():
+						case <-s.Done():
+							break read
+						case <-timer.C:
+							break read
+						}
+					}
+					h.Unsubscribe(s)
+					select {
+					case <-stop:
+						return
+					default:
+					}
+				}
+			}(user, Policy(i%2))
+		}
+	}
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := int64(0); j < 2000; j++ {
+				h.Publish(j%4+1, event(j))
+				h.Connections(j%4 + 1)
+				h.Count()
+			}
+		}()
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+	if n := h.Count(); n != 0 {
+		t.Errorf("got %d connections after everyone left, want 0", n)
+	}
+}
+
+func TestHub_Close(t *testing.T) {
+	h := New(10)
+	s := h.Subscribe(1, Drop)
+
+	h.Close()
+	h.Close()
+
+	select {
+	case <-h.Closed():
+	default:
+		t.Fatal("Closed is not closed after Close")
+	}
+	select {
+	case <-s.Done():
+		t.Error("subscriber is done, it should end its connection itself")
+	default:
+	}
+}
@@ -1,20 +1,161 @@
 package loader
 
 import (
+	"context"
+	"crypto/x509"
 	"database/sql"
 	"fmt"
 	"github.com/uptrace/bun"
 	"github.com/uptrace/bun/dialect/pgdialect"
 	"github.com/uptrace/bun/driver/pgdriver"
+	"go.uber.org/zap"
+	"net"
+	"net/url"
+	"os"
+	"slices"
 	"sparky-back/internal/models"
+	"strconv"
+	"time"
 )
 
-const DsnTemplate = "postgres://%s:%s@%s:%d/%s?sslmode=disable"
+const (
+	minPingBackoff = 100 * time.Millisecond
+	maxPingBackoff = 5 * time.Second
+	// readTimeoutMargin lets the server cancel a slow statement before the client gives up on it
+	readTimeoutMargin = 5 * time.Second
+)
+
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+type Config struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	User     string `yaml:"user"`
+	Password string `yaml:"password"`
+	// PasswordFile keeps the password out of the config, e.g. in a mounted secret
+	PasswordFile string `yaml:"password_file"`
+	DBName       string `yaml:"dbname"`
+	// SSLMode is one of the libpq modes, SSLRootCert is the CA file the server
+	// certificate is verified with
+	SSLMode         string `yaml:"sslmode"`
+	SSLRootCert     string `yaml:"sslrootcert"`
+	ApplicationName string `yaml:"application_name"`
+
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+	// StatementTimeout makes the server cancel longer statements, zero disables it and the
+	// client read timeout with it
+	StatementTimeout time.Duration `yaml:"statement_timeout"`
+	// ConnectTimeout bounds retrying the database at startup, zero tries once
+	ConnectTimeout time.Duration `yaml:"connect_timeout"`
+}
+
+// Validate checks what would otherwise fail only on the first connection.
+func (c Config) Validate() error {
+	if c.SSLMode != "" && !slices.Contains(sslModes, c.SSLMode) {
+		return fmt.Errorf("unknown sslmode %q", c.SSLMode)
+	}
+	if c.SSLRootCert != "" {
+		ca, err := os.ReadFile(c.SSLRootCert)
+		if err != nil {
+			return fmt.Errorf("read sslrootcert: %w", err)
+		}
+		if !x509.NewCertPool().AppendCertsFromPEM(ca) {
+			return fmt.Errorf("sslrootcert %s has no PEM certificates", c.SSLRootCert)
+		}
+	}
+	if c.MaxOpenConns < 0 || c.MaxIdleConns < 0 || c.ConnMaxLifetime < 0 || c.ConnMaxIdleTime < 0 ||
+		c.StatementTimeout < 0 || c.ConnectTimeout < 0 {
+		return fmt.Errorf("pool sizes and timeouts must not be negative")
+	}
+	return nil
+}
 
-func New(host string, port int, user, password, dbName string) *bun.DB {
-	dsn := fmt.Sprintf(DsnTemplate, user, password, host, port, dbName)
-	pgdb := sql.OpenDB(pgdriver.NewConnector(pgdriver.WithDSN(dsn)))
+func (c Config) dsn() string {
+	q := url.Values{}
+	q.Set("sslmode", c.SSLMode)
+	if c.SSLMode == "" {
+		q.Set("sslmode", "disable")
+	}
+	if c.SSLRootCert != "" {
+		q.Set("sslrootcert", c.SSLRootCert)
+	}
+	if c.ApplicationName != "" {
+		q.Set("application_name", c.ApplicationName)
+	}
+	u := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(c.User, c.Password),
+		Host:     net.JoinHostPort(c.Host, strconv.Itoa(c.Port)),
+		Path:     "/" + c.DBName,
+		RawQuery: q.Encode(),
+	}
+	return u.String()
+}
+
+// driverOptions sets the read timeout along with the statement timeout, the driver's own
+// default of 10s would end longer statements otherwise.
+func (c Config) driverOptions() []pgdriver.Option {
+	opts := []pgdriver.Option{pgdriver.WithDSN(c.dsn())}
+	if c.StatementTimeout <= 0 {
+		// no deadline, statements run as long as they need
+		return append(opts, pgdriver.WithReadTimeout(0))
+	}
+	return append(opts,
+		pgdriver.WithConnParams(map[string]interface{}{
+			"statement_timeout": c.StatementTimeout.Milliseconds(),
+		}),
+		pgdriver.WithReadTimeout(c.StatementTimeout+readTimeoutMargin),
+	)
+}
+
+// New connects to the database, retrying until cfg.ConnectTimeout, so the server
+// does not start with a database it cannot reach.
+func New(ctx context.Context, cfg Config) (*bun.DB, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("database config: %w", err)
+	}
+	pgdb := sql.OpenDB(pgdriver.NewConnector(cfg.driverOptions()...))
+	pgdb.SetMaxOpenConns(cfg.MaxOpenConns)
+	pgdb.SetMaxIdleConns(cfg.MaxIdleConns)
+	pgdb.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	pgdb.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 	db := bun.NewDB(pgdb, pgdialect.New())
-	db.RegisterModel((*models.Message)(nil), (*models.Reaction)(nil), (*models.User)(nil))
-	return db
+	db.RegisterModel((*models.Message)(nil), (*models.MessageEdit)(nil), (*models.Attachment)(nil), (*models.Reaction)(nil), (*models.User)(nil), (*models.Photo)(nil))
+
+	if err := ping(ctx, db, cfg.ConnectTimeout); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to %s: %w", net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)), err)
+	}
+	return db, nil
+}
+
+// ping retries with exponential backoff, a database starting along with the server
+// usually comes up within seconds.
+func ping(ctx context.Context, db *bun.DB, timeout time.Duration) error {
+	if timeout <= 0 {
+		return db.PingContext(ctx)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	backoff := minPingBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+		deadline, _ := ctx.Deadline()
+		if ctx.Err() != nil || time.Until(deadline) < backoff {
+			return fmt.Errorf("ping after %d attempts: %w", attempt, err)
+		}
+		zap.S().With("attempt", attempt, "retry_in", backoff).Warn(fmt.Errorf("pinging database: %w", err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("ping after %d attempts: %w", attempt, err)
+		}
+		backoff = min(2*backoff, maxPingBackoff)
+	}
 }
@@ -0,0 +1,91 @@
+package loader
+
+import (
+	"github.com/uptrace/bun/driver/pgdriver"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestConfig_DSN(t *testing.T) {
+	cfg := Config{
+		Host:            "db",
+		Port:            5432,
+		User:            "sparky",
+		Password:        "p@ss/word?#",
+		DBName:          "sparky",
+		SSLMode:         "verify-full",
+		SSLRootCert:     "/etc/ssl/ca.pem",
+		ApplicationName: "sparky-back",
+	}
+	u, err := url.Parse(cfg.dsn())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if password, _ := u.User.Password(); password != cfg.Password {
+		t.Errorf("got password %q, want %q", password, cfg.Password)
+	}
+	if u.Host != "db:5432" || u.Path != "/sparky" {
+		t.Errorf("got host %q and path %q", u.Host, u.Path)
+	}
+	q := u.Query()
+	if q.Get("sslmode") != "verify-full" || q.Get("sslrootcert") != "/etc/ssl/ca.pem" || q.Get("application_name") != "sparky-back" {
+		t.Errorf("got query %v", q)
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	notPEM := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(notPEM, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"unknown sslmode", Config{SSLMode: "on"}},
+		{"missing ca", Config{SSLMode: "verify-ca", SSLRootCert: filepath.Join(t.TempDir(), "none.pem")}},
+		{"bad ca", Config{SSLMode: "verify-ca", SSLRootCert: notPEM}},
+		{"negative pool", Config{MaxOpenConns: -1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cfg.Validate(); err == nil {
+				t.Error("got no error")
+			}
+		})
+	}
+	if err := (Config{SSLMode: "require"}).Validate(); err != nil {
+		t.Errorf("got error %v for a valid config", err)
+	}
+}
+
+func TestConfig_DriverOptions(t *testing.T) {
+	tests := []struct {
+		name             string
+		statementTimeout time.Duration
+		wantRead         time.Duration
+		wantParam        any
+	}{
+		{name: "no statement timeout", wantRead: 0},
+		{name: "statement timeout", statementTimeout: 30 * time.Second, wantRead: 30*time.Second + readTimeoutMargin, wantParam: int64(30000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Host: "db", Port: 5432, User: "sparky", DBName: "sparky", StatementTimeout: tt.statementTimeout}
+			// the driver default the options must override
+			driverCfg := &pgdriver.Config{ReadTimeout: 10 * time.Second}
+			for _, opt := range cfg.driverOptions() {
+				opt(driverCfg)
+			}
+			if driverCfg.ReadTimeout != tt.wantRead {
+				t.Errorf("got read timeout %s, want %s", driverCfg.ReadTimeout, tt.wantRead)
+			}
+			if got := driverCfg.ConnParams["statement_timeout"]; got != tt.wantParam {
+				t.Errorf("got statement_timeout %v, want %v", got, tt.wantParam)
+			}
+		})
+	}
+}
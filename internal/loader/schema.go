@@ -0,0 +1,52 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// SchemaVersion is the schema cmd/migrator creates, bump it with every change to the migrator.
+const SchemaVersion = 2
+
+var ErrSchemaOutdated = errors.New("database schema is outdated, run the migrator")
+
+// schemaVersion is the only row of the schema_version table.
+type schemaVersion struct {
+	bun.BaseModel `bun:"table:schema_version"`
+	ID            int       `bun:"id,pk"`
+	Version       int       `bun:"version,notnull"`
+	MigratedAt    time.Time `bun:"migrated_at,notnull"`
+}
+
+// SetSchemaVersion records that the database is migrated to SchemaVersion.
+func SetSchemaVersion(ctx context.Context, db *bun.DB) error {
+	_, err := db.NewCreateTable().Model((*schemaVersion)(nil)).IfNotExists().Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("create schema_version table: %w", err)
+	}
+	_, err = db.NewInsert().
+		Model(&schemaVersion{ID: 1, Version: SchemaVersion, MigratedAt: time.Now()}).
+		On("CONFLICT (id) DO UPDATE").
+		Set("version = EXCLUDED.version, migrated_at = EXCLUDED.migrated_at").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("insert query: %w", err)
+	}
+	return nil
+}
+
+// CheckSchemaVersion fails unless the database is migrated to SchemaVersion or later.
+func CheckSchemaVersion(ctx context.Context, db *bun.DB) error {
+	var version int
+	err := db.NewSelect().Model((*schemaVersion)(nil)).Column("version").Where("id = 1").Scan(ctx, &version)
+	if err != nil {
+		return fmt.Errorf("select query: %w", err)
+	}
+	if version < SchemaVersion {
+		return fmt.Errorf("%w: version %d, want %d", ErrSchemaOutdated, version, SchemaVersion)
+	}
+	return nil
+}
@@ -0,0 +1,305 @@
+package logic
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"io"
+	"net/url"
+	"slices"
+	"sparky-back/internal/models"
+	"sparky-back/pkg/blobstore"
+	"sparky-back/pkg/imaging"
+	"sparky-back/pkg/urlsign"
+	"strconv"
+	"time"
+)
+
+const (
+	maxAttachments = 4
+	maxVoiceBytes  = 2 << 20
+	attachmentURL  = "/attachment/"
+	// attachmentKeyPrefix keeps attachment keys out of imageKeyRe, so /static never serves them
+	attachmentKeyPrefix = "att_"
+)
+
+var (
+	attachmentSizes  = []int{256, 1080}
+	attachmentLimits = imaging.Limits{
+		MaxBytes:     10 << 20,
+		MaxDimension: 8000,
+		MaxPixels:    40_000_000,
+	}
+)
+
+var (
+	ErrTooManyAttachments    = fmt.Errorf("message can not have more than %d attachments", maxAttachments)
+	ErrUnsupportedAttachment = errors.New("attachment is neither a jpeg, png or webp image nor an ogg, mp4, webm or mp3 voice clip")
+	ErrVoiceTooLarge         = fmt.Errorf("voice clip can not be larger than %d bytes", maxVoiceBytes)
+)
+
+// voiceFormat is an audio container recognized by its magic bytes.
+type voiceFormat struct {
+	match       func(header []byte) bool
+	contentType string
+	ext         string
+}
+
+var voiceFormats = []voiceFormat{
+	{
+		match:       func(h []byte) bool { return bytes.HasPrefix(h, []byte("OggS")) },
+		contentType: "audio/ogg",
+		ext:         ".ogg",
+	},
+	{
+		match:       func(h []byte) bool { return len(h) >= 8 && bytes.Equal(h[4:8], []byte("ftyp")) },
+		contentType: "audio/mp4",
+		ext:         ".m4a",
+	},
+	{
+		match:       func(h []byte) bool { return bytes.HasPrefix(h, []byte("\x1a\x45\xdf\xa3")) },
+		contentType: "audio/webm",
+		ext:         ".webm",
+	},
+	{
+		match: func(h []byte) bool {
+			return bytes.HasPrefix(h, []byte("ID3")) || len(h) >= 2 && h[0] == 0xff && h[1]&0xe0 == 0xe0
+		},
+		contentType: "audio/mpeg",
+		ext:         ".mp3",
+	},
+}
+
+// AttachmentService stores message attachments in the same blob store as photos.
+// Attachments are served only to the sender and the receiver of their message,
+// by urls signed for one of them.
+type AttachmentService struct {
+	db     *bun.DB
+	store  blobstore.BlobStore
+	signer *urlsign.Signer
+}
+
+func NewAttachmentService(db *bun.DB, store blobstore.BlobStore, signer *urlsign.Signer) *AttachmentService {
+	return &AttachmentService{
+		db:     db,
+		store:  store,
+		signer: signer,
+	}
+}
+
+// save validates and stores the files of a message that is not inserted yet.
+// On error no file is left in the store.
+func (s *AttachmentService) save(ctx context.Context, files []io.Reader) ([]models.Attachment, error) {
+	if len(files) > maxAttachments {
+		return nil, ErrTooManyAttachments
+	}
+	attachments := make([]models.Attachment, 0, len(files))
+	for i, file := range files {
+		attachment, err := s.saveFile(ctx, file)
+		if err != nil {
+			s.deleteFiles(ctx, attachments)
+			return nil, fmt.Errorf("attachment %d: %w", i, err)
+		}
+		attachments = append(attachments, *attachment)
+	}
+	return attachments, nil
+}
+
+func (s *AttachmentService) saveFile(ctx context.Context, file io.Reader) (*models.Attachment, error) {
+	r := bufio.NewReader(file)
+	header, err := r.Peek(12)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("reading header: %w", err)
+	}
+	if _, err = imaging.Detect(header); err == nil {
+		return s.saveImage(ctx, r)
+	}
+	for _, format := range voiceFormats {
+		if format.match(header) {
+			return s.saveVoice(ctx, r, format)
+		}
+	}
+	return nil, ErrUnsupportedAttachment
+}
+
+// saveImage re-encodes the image like profile photos, so it carries no metadata.
+func (s *AttachmentService) saveImage(ctx context.Context, r io.Reader) (*models.Attachment, error) {
+	res, err := imaging.Process(r, attachmentLimits, attachmentSizes)
+	if err != nil {
+		return nil, fmt.Errorf("processing image: %w", err)
+	}
+	attachment := &models.Attachment{
+		Kind:        models.AttachmentImage,
+		Path:        attachmentKeyPrefix + uuid.New().String() + res.Original.Ext,
+		ContentType: res.Original.ContentType,
+		Size:        int64(len(res.Original.Data)),
+	}
+	err = s.store.Put(ctx, attachment.Path, bytes.NewReader(res.Original.Data), attachment.Size, attachment.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("storing original: %w", err)
+	}
+	for _, size := range attachmentSizes {
+		thumb := res.Thumbnails[size]
+		err = s.store.Put(ctx, thumbnailKey(attachment.Path, size), bytes.NewReader(thumb.Data), int64(len(thumb.Data)), thumb.ContentType)
+		if err != nil {
+			s.deleteFiles(ctx, []models.Attachment{*attachment})
+			return nil, fmt.Errorf("storing %d thumbnail: %w", size, err)
+		}
+		attachment.Sizes = append(attachment.Sizes, size)
+	}
+	return attachment, nil
+}
+
+// saveVoice stores the clip as is, only its container is checked.
+func (s *AttachmentService) saveVoice(ctx context.Context, r io.Reader, format voiceFormat) (*models.Attachment, error) {
+	data, err := io.ReadAll(io.LimitReader(r, maxVoiceBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading voice clip: %w", err)
+	}
+	if len(data) > maxVoiceBytes {
+		return nil, ErrVoiceTooLarge
+	}
+	attachment := &models.Attachment{
+		Kind:        models.AttachmentVoice,
+		Path:        attachmentKeyPrefix + uuid.New().String() + format.ext,
+		ContentType: format.contentType,
+		Size:        int64(len(data)),
+	}
+	err = s.store.Put(ctx, attachment.Path, bytes.NewReader(data), attachment.Size, attachment.ContentType)
+	if err != nil {
+		return nil, fmt.Errorf("storing voice clip: %w", err)
+	}
+	return attachment, nil
+}
+
+func (s *AttachmentService) insert(ctx context.Context, tx bun.Tx, messageID int64, attachments []models.Attachment) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	for i := range attachments {
+		attachments[i].MessageID = messageID
+	}
+	_, err := tx.NewInsert().Model(&attachments).Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("insert query: %w", err)
+	}
+	return nil
+}
+
+// Open opens an attachment, or one of its thumbnails if size is set, for a user of its conversation
+// and returns when its url expires. The caller must close the returned object.
+func (s *AttachmentService) Open(ctx context.Context, userID, attachmentID int64, size int, expires, sig string) (*blobstore.Object, time.Time, error) {
+	expiresAt, err := s.signer.Verify(attachmentPath(attachmentID, userID, size), expires, sig)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("%w: %w", ErrFileForbidden, err)
+	}
+	attachment := new(models.Attachment)
+	err = s.db.NewSelect().
+		Model(attachment).
+		Join("JOIN messages AS m ON m.id = a.message_id").
+		Where("a.id = ?", attachmentID).
+		Where("m.user_id = ? OR m.to_id = ?", userID, userID).
+		Where("m.deleted_at IS NULL").
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, time.Time{}, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("select query: %w", err)
+	}
+	key := attachment.Path
+	if size != 0 {
+		if !slices.Contains(attachment.Sizes, size) {
+			return nil, time.Time{}, ErrFileNotFound
+		}
+		key = thumbnailKey(attachment.Path, size)
+	}
+	obj, err := s.store.Get(ctx, key)
+	if errors.Is(err, blobstore.ErrNotExist) {
+		return nil, time.Time{}, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("getting blob: %w", err)
+	}
+	return obj, expiresAt, nil
+}
+
+// FillURLs sets the urls of all attachments of the messages, signed for userID.
+// Attachments of deleted messages are kept for moderation, but no user sees them.
+func (s *AttachmentService) FillURLs(userID int64, messages []models.Message) {
+	for i := range messages {
+		s.fillURLs(userID, &messages[i])
+	}
+}
+
+func (s *AttachmentService) fillURLs(userID int64, message *models.Message) {
+	if message.DeletedAt != nil {
+		message.Attachments = nil
+		return
+	}
+	for i := range message.Attachments {
+		attachment := &message.Attachments[i]
+		attachment.URL = s.url(attachment.ID, userID, 0)
+		if len(attachment.Sizes) == 0 {
+			continue
+		}
+		attachment.URLs = map[string]string{
+			originalURL: attachment.URL,
+		}
+		for _, size := range attachment.Sizes {
+			attachment.URLs[strconv.Itoa(size)] = s.url(attachment.ID, userID, size)
+		}
+	}
+}
+
+func (s *AttachmentService) url(attachmentID, userID int64, size int) string {
+	path := attachmentPath(attachmentID, userID, size)
+	return path + "&" + s.signer.Params(path).Encode()
+}
+
+// attachmentPath is the url of an attachment before signing, the signature covers the user
+// and the size, so a url works only for the user it was given to.
+func attachmentPath(attachmentID, userID int64, size int) string {
+	query := url.Values{}
+	query.Set("user_id", strconv.FormatInt(userID, 10))
+	if size != 0 {
+		query.Set("size", strconv.Itoa(size))
+	}
+	return attachmentURL + strconv.FormatInt(attachmentID, 10) + "?" + query.Encode()
+}
+
+// keys returns the keys of every file the attachments refer to.
+func (s *AttachmentService) keys(ctx context.Context) ([]string, error) {
+	attachments := make([]models.Attachment, 0)
+	err := s.db.NewSelect().Model(&attachments).Column("path", "sizes").Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select query: %w", err)
+	}
+	keys := make([]string, 0, len(attachments))
+	for i := range attachments {
+		keys = append(keys, attachmentKeys(&attachments[i])...)
+	}
+	return keys, nil
+}
+
+// deleteFiles is a cleanup after a failed upload, files it fails to remove are left to CleanOrphans.
+func (s *AttachmentService) deleteFiles(ctx context.Context, attachments []models.Attachment) {
+	for i := range attachments {
+		for _, key := range attachmentKeys(&attachments[i]) {
+			s.store.Delete(ctx, key)
+		}
+	}
+}
+
+func attachmentKeys(attachment *models.Attachment) []string {
+	keys := []string{attachment.Path}
+	for _, size := range attachment.Sizes {
+		keys = append(keys, thumbnailKey(attachment.Path, size))
+	}
+	return keys
+}
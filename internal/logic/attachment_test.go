@@ -0,0 +1,89 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"sparky-back/internal/models"
+	"sparky-back/pkg/urlsign"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAttachmentService_FillURLs(t *testing.T) {
+	s := NewAttachmentService(nil, nil, urlsign.New([]byte("secret"), time.Hour))
+	now := time.Now()
+	messages := []models.Message{
+		{MessageID: 1, Attachments: []models.Attachment{{ID: 7, Sizes: []int{256}}}},
+		{MessageID: 2, DeletedAt: &now, Attachments: []models.Attachment{{ID: 8}}},
+	}
+	s.FillURLs(5, messages)
+
+	if messages[1].Attachments != nil {
+		t.Errorf("got attachments %+v of a deleted message, want none", messages[1].Attachments)
+	}
+	attachment := messages[0].Attachments[0]
+	if attachment.URLs[originalURL] != attachment.URL || attachment.URLs["256"] == "" {
+		t.Fatalf("got urls %v", attachment.URLs)
+	}
+	for _, size := range []int{0, 256} {
+		raw := attachment.URL
+		if size != 0 {
+			raw = attachment.URLs["256"]
+		}
+		u, err := url.Parse(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query := u.Query()
+		if !strings.HasPrefix(raw, "/attachment/7?") || query.Get("user_id") != "5" {
+			t.Errorf("got url %s, want one for attachment 7 and user 5", raw)
+		}
+		if _, err = s.signer.Verify(attachmentPath(7, 5, size), query.Get(urlsign.ExpiresParam), query.Get(urlsign.SignatureParam)); err != nil {
+			t.Errorf("url %s does not verify: %v", raw, err)
+		}
+		// the signature is bound to the user and the size
+		if _, err = s.signer.Verify(attachmentPath(7, 6, size), query.Get(urlsign.ExpiresParam), query.Get(urlsign.SignatureParam)); err == nil {
+			t.Errorf("url %s verifies for another user", raw)
+		}
+	}
+}
+
+func TestAttachmentService_OpenForbidden(t *testing.T) {
+	s := NewAttachmentService(nil, nil, urlsign.New([]byte("secret"), time.Hour))
+	_, _, err := s.Open(context.Background(), 5, 7, 0, "", "")
+	if !errors.Is(err, ErrFileForbidden) {
+		t.Errorf("got %v for an unsigned url, want ErrFileForbidden", err)
+	}
+}
+
+func TestVoiceFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{"ogg", "OggS\x00\x02\x00\x00\x00\x00\x00\x00", "audio/ogg"},
+		{"m4a", "\x00\x00\x00\x20ftypM4A ", "audio/mp4"},
+		{"webm", "\x1a\x45\xdf\xa3\x9f\x42\x86\x81\x01\x42\xf7\x81", "audio/webm"},
+		{"mp3 id3", "ID3\x04\x00\x00\x00\x00\x00\x00\x00\x00", "audio/mpeg"},
+		{"mp3 frame", "\xff\xfb\x90\x64\x00\x00\x00\x00\x00\x00\x00\x00", "audio/mpeg"},
+		{"short", "\x00\x00", ""},
+		{"text", "hello, world", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			for _, format := range voiceFormats {
+				if format.match([]byte(tt.header)) {
+					got = format.contentType
+					break
+				}
+			}
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
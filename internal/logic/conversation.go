@@ -0,0 +1,105 @@
+package logic
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"slices"
+	"sparky-back/internal/models"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// GetConversations returns one entry per chat partner of the user, most recent first.
+func (l *Logic) GetConversations(ctx context.Context, userID int64) ([]models.Conversation, error) {
+	ctx, span := tracer.Start(ctx, "Logic.GetConversations")
+	defer span.End()
+	const partnerExpr = "CASE WHEN m.user_id = ? THEN m.to_id ELSE m.user_id END"
+	lastMessages := make([]models.Message, 0)
+	err := l.db.NewSelect().
+		Model(&lastMessages).
+		Relation("Attachments").
+		DistinctOn(partnerExpr, userID).
+		Where("m.user_id = ? OR m.to_id = ?", userID, userID).
+		OrderExpr(partnerExpr+", m.id DESC", userID).
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("last messages select query: %w", err)
+	}
+
+	var unread []struct {
+		PartnerID int64 `bun:"partner_id"`
+		Count     int   `bun:"count"`
+	}
+	err = l.db.NewSelect().
+		Model((*models.Message)(nil)).
+		ColumnExpr("m.user_id AS partner_id, count(*) AS count").
+		Where("m.to_id = ?", userID).
+		Where("m.read_at IS NULL").
+		Where("m.deleted_at IS NULL").
+		Group("m.user_id").
+		Scan(ctx, &unread)
+	if err != nil {
+		return nil, fmt.Errorf("unread select query: %w", err)
+	}
+	l.attachments.FillURLs(userID, lastMessages)
+	unreadCounts := make(map[int64]int, len(unread))
+	for _, u := range unread {
+		unreadCounts[u.PartnerID] = u.Count
+	}
+
+	conversations := make([]models.Conversation, 0, len(lastMessages))
+	for _, msg := range lastMessages {
+		partnerID := msg.ToID
+		if msg.ToID == userID {
+			partnerID = msg.UserID
+		}
+		conversations = append(conversations, models.Conversation{
+			PartnerID:   partnerID,
+			LastMessage: msg,
+			UnreadCount: unreadCounts[partnerID],
+		})
+	}
+	slices.SortFunc(conversations, func(a, b models.Conversation) int {
+		return cmp.Compare(b.LastMessage.MessageID, a.LastMessage.MessageID)
+	})
+	return conversations, nil
+}
+
+// GetConversationMessages returns a page of the conversation in ascending id order.
+func (l *Logic) GetConversationMessages(ctx context.Context, page *models.Page) ([]models.Message, error) {
+	ctx, span := tracer.Start(ctx, "Logic.GetConversationMessages")
+	defer span.End()
+	limit := page.Limit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	limit = min(limit, maxPageLimit)
+
+	messages := make([]models.Message, 0)
+	q := l.db.NewSelect().
+		Model(&messages).
+		Relation("Attachments").
+		Where("(m.user_id = ? AND m.to_id = ?) OR (m.user_id = ? AND m.to_id = ?)",
+			page.UserID, page.PartnerID, page.PartnerID, page.UserID).
+		Limit(limit)
+	if page.After != 0 {
+		q = q.Where("m.id > ?", page.After).Order("m.id ASC")
+	} else {
+		q = q.Order("m.id DESC")
+	}
+	if page.Before != 0 {
+		q = q.Where("m.id < ?", page.Before)
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("select query: %w", err)
+	}
+	if page.After == 0 {
+		slices.Reverse(messages)
+	}
+	l.attachments.FillURLs(page.UserID, messages)
+	return messages, nil
+}
@@ -0,0 +1,131 @@
+package logic
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"sparky-back/internal/models"
+	"strings"
+	"time"
+)
+
+// editWindow is how long after sending a message can be edited.
+const editWindow = 15 * time.Minute
+
+var (
+	ErrMessageNotFound = errors.New("message not found")
+	ErrMessageDeleted  = errors.New("message is deleted")
+	ErrEditWindow      = fmt.Errorf("message can be edited only within %s after sending", editWindow)
+	ErrEmptyText       = errors.New("message text is empty, delete the message instead")
+)
+
+// EditMessage replaces the text of a message userID sent and tells both users about it.
+func (l *Logic) EditMessage(ctx context.Context, userID, messageID int64, text string) (*models.Message, error) {
+	ctx, span := tracer.Start(ctx, "Logic.EditMessage")
+	defer span.End()
+	if strings.TrimSpace(text) == "" {
+		return nil, ErrEmptyText
+	}
+	message, err := l.changeMessage(ctx, userID, messageID, func(message *models.Message, now time.Time) error {
+		if now.Sub(message.Time) > editWindow {
+			return ErrEditWindow
+		}
+		message.Text, message.EditedAt = text, &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.deliverChange(ctx, message)
+	return message, nil
+}
+
+// DeleteMessage deletes a message userID sent for both users. The message stays as a tombstone,
+// so clients that have it know to remove it, its attachments are only hidden.
+func (l *Logic) DeleteMessage(ctx context.Context, userID, messageID int64) (*models.Message, error) {
+	ctx, span := tracer.Start(ctx, "Logic.DeleteMessage")
+	defer span.End()
+	message, err := l.changeMessage(ctx, userID, messageID, func(message *models.Message, now time.Time) error {
+		message.Text, message.DeletedAt = "", &now
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	l.deliverChange(ctx, message)
+	return message, nil
+}
+
+// changeMessage applies change to a message userID sent and keeps its previous text in message_edits.
+func (l *Logic) changeMessage(ctx context.Context, userID, messageID int64, change func(*models.Message, time.Time) error) (*models.Message, error) {
+	message := new(models.Message)
+	err := l.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		err := tx.NewSelect().
+			Model(message).
+			Relation("Attachments").
+			Where("m.id = ?", messageID).
+			Where("m.user_id = ?", userID).
+			For("UPDATE OF m").
+			Scan(ctx)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				return ErrMessageNotFound
+			}
+			return fmt.Errorf("select query: %w", err)
+		}
+		if message.DeletedAt != nil {
+			return ErrMessageDeleted
+		}
+		now := time.Now()
+		edit := &models.MessageEdit{
+			MessageID: message.MessageID,
+			Text:      message.Text,
+			EditedAt:  now,
+		}
+		if err = change(message, now); err != nil {
+			return err
+		}
+		_, err = tx.NewInsert().Model(edit).Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("insert edit query: %w", err)
+		}
+		_, err = tx.NewUpdate().
+			Model(message).
+			Column("text", "edited_at", "deleted_at").
+			WherePK().
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("update query: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// attachments of a deleted message stay with its previous text, fillURLs hides them
+	l.attachments.fillURLs(userID, message)
+	return message, nil
+}
+
+func (l *Logic) deliverChange(ctx context.Context, message *models.Message) {
+	event := changeEvent(message)
+	l.deliver(ctx, message.UserID, event)
+	l.deliver(ctx, message.ToID, event)
+}
+
+// changeEvent carries the whole changed message, so clients can apply it more than once.
+func changeEvent(message *models.Message) models.Event {
+	eventType := models.EventEdit
+	if message.DeletedAt != nil {
+		eventType = models.EventDelete
+	}
+	return models.Event{
+		Type:      eventType,
+		UserID:    message.UserID,
+		ToID:      message.ToID,
+		MessageID: message.MessageID,
+		Message:   message,
+	}
+}
@@ -0,0 +1,31 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"sparky-back/internal/models"
+	"testing"
+	"time"
+)
+
+func TestChangeEvent(t *testing.T) {
+	now := time.Now()
+	edited := &models.Message{MessageID: 3, UserID: 1, ToID: 2, EditedAt: &now}
+	if event := changeEvent(edited); event.Type != models.EventEdit || event.MessageID != 3 || event.Message != edited {
+		t.Errorf("got %+v, want an edit event of the message", event)
+	}
+	deleted := &models.Message{MessageID: 3, UserID: 1, ToID: 2, EditedAt: &now, DeletedAt: &now}
+	if event := changeEvent(deleted); event.Type != models.EventDelete {
+		t.Errorf("got %s, want a delete event for a tombstone", event.Type)
+	}
+}
+
+func TestLogic_EditMessageEmptyText(t *testing.T) {
+	for _, text := range []string{"", "  \n\t"} {
+		// the text is checked before the database is used
+		_, err := (&Logic{}).EditMessage(context.Background(), 1, 3, text)
+		if !errors.Is(err, ErrEmptyText) {
+			t.Errorf("text %q: got error %v, want ErrEmptyText", text, err)
+		}
+	}
+}
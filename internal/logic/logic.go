@@ -2,67 +2,88 @@ package logic
 
 import (
 	"context"
-	"encoding/json"
+	"database/sql"
+	"errors"
 	"fmt"
-	"github.com/google/uuid"
 	"github.com/uptrace/bun"
 	"golang.org/x/crypto/bcrypt"
 	"io"
-	"mime/multipart"
-	"os"
 	"slices"
+	"sparky-back/internal/hub"
+	"sparky-back/internal/metrics"
 	"sparky-back/internal/models"
-	"sync"
+	"sparky-back/internal/pubsub"
+	"sparky-back/pkg/blobstore"
+	"sparky-back/pkg/zaplogger"
 	"time"
 )
 
 const (
-	staticPath            = "static/"
 	dbBufSize             = 1000
-	clientBufSize         = 100
 	defaultContextTimeout = 2 * time.Second
 )
 
+var (
+	ErrDisconnected = errors.New("connection is too slow, reconnect")
+	ErrGoingAway    = errors.New("server is shutting down, reconnect")
+)
+
 type Logic struct {
-	db       *bun.DB
-	dbCh     chan models.Message
-	mu       sync.Mutex
-	clientCh map[int64]chan models.Message
+	db          *bun.DB
+	photos      *PhotoService
+	attachments *AttachmentService
+	dbCh        chan models.Message
+	hub         *hub.Hub
+	pubsub      pubsub.PubSub
 }
 
-func NewLogic(db *bun.DB) *Logic {
+// NewLogic needs ps to deliver the events it publishes to h.
+func NewLogic(db *bun.DB, photos *PhotoService, attachments *AttachmentService, h *hub.Hub, ps pubsub.PubSub) *Logic {
 	logic := &Logic{
-		db:       db,
-		clientCh: make(map[int64]chan models.Message),
-		dbCh:     make(chan models.Message, dbBufSize),
+		db:          db,
+		photos:      photos,
+		attachments: attachments,
+		hub:         h,
+		pubsub:      ps,
+		dbCh:        make(chan models.Message, dbBufSize),
 	}
 	return logic
 }
 
-func (l *Logic) AddUser(ctx context.Context, user *models.User) (int64, error) {
+func (l *Logic) AddUser(ctx context.Context, user *models.User, img io.Reader) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Logic.AddUser")
+	defer span.End()
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
 	if err != nil {
 		return 0, fmt.Errorf("hashing password: %w", err)
 	}
 	user.Password = string(hashedPassword)
-	_, err = l.db.NewInsert().Model(user).Exec(ctx)
+	err = l.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		_, err := tx.NewInsert().Model(user).Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("insert query: %w", err)
+		}
+		photo, err := l.photos.add(ctx, tx, user.ID, img)
+		if err != nil {
+			return fmt.Errorf("adding photo: %w", err)
+		}
+		user.Photos = []models.Photo{*photo}
+		return nil
+	})
 	if err != nil {
-		return 0, fmt.Errorf("insert query: %w", err)
+		return 0, err
 	}
 	return user.ID, nil
 }
 
 func (l *Logic) UpdateUser(ctx context.Context, user *models.User) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Logic.UpdateUser")
+	defer span.End()
 	oldUser := new(models.User)
 	err := l.db.NewSelect().Model(oldUser).Where("id = ?", user.ID).Scan(ctx)
 	if err != nil {
 		return 0, fmt.Errorf("select query: %w", err)
 	}
-	if user.ImgPath == "" {
-		user.ImgPath = oldUser.ImgPath
-	} else {
-		l.DeleteImg(oldUser.ImgPath)
-	}
 	if user.Description == "" {
 		user.Description = oldUser.Description
 	}
@@ -74,8 +95,8 @@ func (l *Logic) UpdateUser(ctx context.Context, user *models.User) (int64, error
 	}
 	_, err = l.db.NewUpdate().
 		Model(user).
-		Set("description = ?, img_path = ?, latitude = ?, longitude = ?",
-			user.Description, user.ImgPath, user.Latitude, user.Longitude).
+		Set("description = ?, latitude = ?, longitude = ?",
+			user.Description, user.Latitude, user.Longitude).
 		Where("id = ?", user.ID).
 		Exec(ctx)
 	if err != nil {
@@ -84,51 +105,84 @@ func (l *Logic) UpdateUser(ctx context.Context, user *models.User) (int64, error
 	return user.ID, nil
 }
 
-func (l *Logic) SaveImg(file multipart.File, filename string) (string, error) {
-	filePath := staticPath + uuid.New().String() + filename
-	dst, err := os.Create(filePath)
+func (l *Logic) AddPhoto(ctx context.Context, userID int64, img io.Reader) (*models.Photo, error) {
+	ctx, span := tracer.Start(ctx, "Logic.AddPhoto")
+	defer span.End()
+	return l.photos.Add(ctx, userID, img)
+}
+
+func (l *Logic) ReplacePrimaryPhoto(ctx context.Context, userID int64, img io.Reader) (*models.Photo, error) {
+	ctx, span := tracer.Start(ctx, "Logic.ReplacePrimaryPhoto")
+	defer span.End()
+	return l.photos.ReplacePrimary(ctx, userID, img)
+}
+
+func (l *Logic) ReorderPhotos(ctx context.Context, userID int64, ids []int64) ([]models.Photo, error) {
+	ctx, span := tracer.Start(ctx, "Logic.ReorderPhotos")
+	defer span.End()
+	return l.photos.Reorder(ctx, userID, ids)
+}
+
+func (l *Logic) DeletePhoto(ctx context.Context, userID, photoID int64) error {
+	ctx, span := tracer.Start(ctx, "Logic.DeletePhoto")
+	defer span.End()
+	return l.photos.Delete(ctx, userID, photoID)
+}
+
+// CleanOrphanFiles removes stored files no photo or attachment refers to.
+func (l *Logic) CleanOrphanFiles(ctx context.Context) (int, error) {
+	ctx, span := tracer.Start(ctx, "Logic.CleanOrphanFiles")
+	defer span.End()
+	keys, err := l.attachments.keys(ctx)
 	if err != nil {
-		return "", fmt.Errorf("error creating image file: %v", err)
-	}
-	defer dst.Close()
-	if _, err = io.Copy(dst, file); err != nil {
-		return "", fmt.Errorf("error copying image file: %v", err)
+		return 0, fmt.Errorf("listing attachment files: %w", err)
 	}
-	return filePath, nil
+	return l.photos.CleanOrphans(ctx, keys...)
 }
 
 func (l *Logic) GetUserByID(ctx context.Context, id int64) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "Logic.GetUserByID")
+	defer span.End()
 	var user models.User
-	err := l.db.NewSelect().Model(&user).Where("id = ?", id).Scan(ctx)
+	err := l.db.NewSelect().Model(&user).Relation("Photos", orderPhotos).Where("id = ?", id).Scan(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("select query: %w", err)
 	}
+	l.photos.FillURLs(user.Photos)
+	l.fillPresence(&user)
 	return &user, nil
 }
 
 func (l *Logic) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, span := tracer.Start(ctx, "Logic.GetUserByEmail")
+	defer span.End()
 	var user models.User
-	err := l.db.NewSelect().Model(&user).Where("email = ?", email).Scan(ctx)
+	err := l.db.NewSelect().Model(&user).Relation("Photos", orderPhotos).Where("email = ?", email).Scan(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("select query: %w", err)
 	}
+	l.photos.FillURLs(user.Photos)
+	l.fillPresence(&user)
 	return &user, nil
 }
 
-func (l *Logic) GetFile(filename string) ([]byte, error) {
-	file, err := os.Open(staticPath + filename)
-	if err != nil {
-		return nil, fmt.Errorf("open file: %w", err)
-	}
-	defer file.Close()
-	data, err := io.ReadAll(file)
-	if err != nil {
-		return nil, fmt.Errorf("reading file: %w", err)
-	}
-	return data, nil
+func (l *Logic) OpenFile(ctx context.Context, key, expires, sig string) (*blobstore.Object, time.Time, error) {
+	ctx, span := tracer.Start(ctx, "Logic.OpenFile")
+	defer span.End()
+	return l.photos.Open(ctx, key, expires, sig)
+}
+
+// OpenAttachment opens an attachment by a url signed for one of the users of its conversation,
+// size selects a thumbnail.
+func (l *Logic) OpenAttachment(ctx context.Context, userID, attachmentID int64, size int, expires, sig string) (*blobstore.Object, time.Time, error) {
+	ctx, span := tracer.Start(ctx, "Logic.OpenAttachment")
+	defer span.End()
+	return l.attachments.Open(ctx, userID, attachmentID, size, expires, sig)
 }
 
 func (l *Logic) LogIn(ctx context.Context, email, password string) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Logic.LogIn")
+	defer span.End()
 	var user models.User
 	err := l.db.NewSelect().Model(&user).Where("email = ?", email).Scan(ctx)
 	if err != nil {
@@ -142,6 +196,8 @@ func (l *Logic) LogIn(ctx context.Context, email, password string) (int64, error
 }
 
 func (l *Logic) SetReaction(ctx context.Context, reaction *models.Reaction) error {
+	ctx, span := tracer.Start(ctx, "Logic.SetReaction")
+	defer span.End()
 	_, err := l.db.NewInsert().Model(reaction).Exec(ctx)
 	if err != nil {
 		return fmt.Errorf("insert reaction: %w", err)
@@ -155,13 +211,14 @@ func (l *Logic) SetReaction(ctx context.Context, reaction *models.Reaction) erro
 		return reaction.UserID == r.ToID
 	}); i != -1 {
 		if user.Reactions[i].Like {
+			metrics.Matches.Inc()
 			message := &models.Message{
 				UserID: reaction.UserID,
 				ToID:   reaction.ToID,
 				Time:   time.Now(),
 				Text:   "",
 			}
-			return l.NewMessage(message)
+			return l.newMessage(ctx, message, models.EventMatch)
 		}
 	} else {
 		if !reaction.Like {
@@ -178,77 +235,307 @@ func (l *Logic) SetReaction(ctx context.Context, reaction *models.Reaction) erro
 	return nil
 }
 
-func (l *Logic) NewMessage(message *models.Message) error {
-	err := l.SaveMessage(context.TODO(), message)
+func (l *Logic) NewMessage(ctx context.Context, message *models.Message, files ...io.Reader) error {
+	ctx, span := tracer.Start(ctx, "Logic.NewMessage")
+	defer span.End()
+	return l.newMessage(ctx, message, models.EventMessage, files...)
+}
+
+// newMessage saves the message with files attached and sends it to both users as an event of eventType.
+func (l *Logic) newMessage(ctx context.Context, message *models.Message, eventType string, files ...io.Reader) error {
+	// the id, the send time and the receipts are set by the server only, the edit window
+	// is measured from the send time
+	message.MessageID, message.DeliveredAt, message.ReadAt = 0, nil, nil
+	message.Time = time.Now()
+	created, err := l.SaveMessage(ctx, message, files...)
 	if err != nil {
 		return fmt.Errorf("save message: %v", err)
 	}
-	if user, ok := l.clientCh[message.UserID]; ok {
-		user <- *message
+	if !created {
+		// a retry, the users got the events on the first try
+		return nil
 	}
-	if to, ok := l.clientCh[message.ToID]; ok {
-		to <- *message
+	event := models.Event{
+		Type:    eventType,
+		Message: message,
 	}
+	l.deliver(ctx, message.UserID, event)
+	l.deliver(ctx, message.ToID, event)
 	return nil
 }
 
-func (l *Logic) SaveMessage(ctx context.Context, message *models.Message) error {
-	_, err := l.db.NewInsert().Model(message).Exec(ctx)
+// HandleEvent processes an event the user sent over a live connection.
+// The returned event, if any, is the answer to the sender's connection only.
+func (l *Logic) HandleEvent(ctx context.Context, userID int64, event models.Event) (*models.Event, error) {
+	ctx, span := tracer.Start(ctx, "Logic.HandleEvent")
+	defer span.End()
+	switch event.Type {
+	case models.EventMessage:
+		message := &models.Message{
+			UserID:   userID,
+			ToID:     event.ToID,
+			ClientID: event.ClientID,
+			Text:     event.Text,
+		}
+		if err := l.NewMessage(ctx, message); err != nil {
+			return nil, fmt.Errorf("new message: %w", err)
+		}
+		return &models.Event{
+			Type:    models.EventAck,
+			Message: message,
+		}, nil
+	case models.EventTyping:
+		if err := l.Typing(ctx, userID, event.ToID); err != nil {
+			return nil, fmt.Errorf("typing: %w", err)
+		}
+		return nil, nil
+	case models.EventRead:
+		if err := l.MarkRead(ctx, userID, event.ToID, event.MessageID); err != nil {
+			return nil, fmt.Errorf("mark read: %w", err)
+		}
+		return nil, nil
+	case models.EventEdit:
+		if _, err := l.EditMessage(ctx, userID, event.MessageID, event.Text); err != nil {
+			return nil, fmt.Errorf("edit message: %w", err)
+		}
+		return nil, nil
+	case models.EventDelete:
+		if _, err := l.DeleteMessage(ctx, userID, event.MessageID); err != nil {
+			return nil, fmt.Errorf("delete message: %w", err)
+		}
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unknown event type %q", event.Type)
+	}
+}
+
+// deliver passes the event to every live connection of the user on any instance.
+// Live delivery is best effort, clients catch up on saved messages when they reconnect.
+func (l *Logic) deliver(ctx context.Context, userID int64, event models.Event) {
+	if err := l.pubsub.Publish(ctx, userID, event); err != nil {
+		zaplogger.FromContext(ctx).With("user_id", userID).With("type", event.Type).Error(fmt.Errorf("publishing event: %w", err))
+	}
+}
+
+// SaveMessage inserts the message with files attached. It reports false if the sender has already
+// sent a message with the same client id, then message is filled from the saved one and files are dropped.
+func (l *Logic) SaveMessage(ctx context.Context, message *models.Message, files ...io.Reader) (bool, error) {
+	ctx, span := tracer.Start(ctx, "Logic.SaveMessage")
+	defer span.End()
+	// a retry of a sent message is answered before its files are stored again
+	if message.ClientID != "" {
+		found, err := l.sentMessage(ctx, l.db, message)
+		if err != nil {
+			return false, err
+		}
+		if found {
+			l.attachments.fillURLs(message.UserID, message)
+			return false, nil
+		}
+	}
+	attachments, err := l.attachments.save(ctx, files)
 	if err != nil {
-		return fmt.Errorf("insert query: %v", err)
+		return false, fmt.Errorf("saving attachments: %w", err)
 	}
-	return nil
+	created := true
+	err = l.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		res, err := tx.NewInsert().
+			Model(message).
+			On("CONFLICT (user_id, client_id) DO NOTHING").
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("insert query: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			// a concurrent retry has saved the message in the meantime
+			created = false
+			_, err = l.sentMessage(ctx, tx, message)
+			return err
+		}
+		return l.attachments.insert(ctx, tx, message.MessageID, attachments)
+	})
+	if err != nil || !created {
+		l.attachments.deleteFiles(ctx, attachments)
+	}
+	if err != nil {
+		return false, err
+	}
+	if created {
+		message.Attachments = attachments
+	}
+	l.attachments.fillURLs(message.UserID, message)
+	return created, nil
+}
+
+// sentMessage fills message from the one the sender has already sent with the same client id.
+func (l *Logic) sentMessage(ctx context.Context, db bun.IDB, message *models.Message) (bool, error) {
+	err := db.NewSelect().
+		Model(message).
+		Relation("Attachments").
+		Where("m.user_id = ?", message.UserID).
+		Where("m.client_id = ?", message.ClientID).
+		Scan(ctx)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("select sent message query: %w", err)
+	}
+	return true, nil
 }
 
+// GetNewMessages returns the messages of msg.UserID after message msg.MessageID,
+// or after msg.Time if the id is not set.
 func (l *Logic) GetNewMessages(ctx context.Context, msg *models.Message) ([]models.Message, error) {
+	ctx, span := tracer.Start(ctx, "Logic.GetNewMessages")
+	defer span.End()
 	messages := make([]models.Message, 0)
-	err := l.db.NewSelect().
+	q := l.db.NewSelect().
 		Model(&messages).
-		Where("user_id = ? OR to_id = ?", msg.UserID, msg.UserID).
-		Where("time > ?", msg.Time).
-		Order("time ASC").
-		Scan(ctx)
+		Relation("Attachments").
+		Where("m.user_id = ? OR m.to_id = ?", msg.UserID, msg.UserID)
+	if msg.MessageID != 0 {
+		q = q.Where("m.id > ?", msg.MessageID)
+	} else {
+		q = q.Where("m.time > ?", msg.Time)
+	}
+	err := q.Order("m.id ASC").Scan(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("select query: %w", err)
 	}
+	l.attachments.FillURLs(msg.UserID, messages)
 	return messages, nil
 }
 
-func (l *Logic) SendMessages(ctx context.Context, send func([]byte), msg *models.Message) error {
-	l.mu.Lock()
-	l.clientCh[msg.UserID] = make(chan models.Message, clientBufSize)
-	l.mu.Unlock()
-	messages, err := l.GetNewMessages(context.TODO(), msg)
+// GetChangedMessages returns the messages of msg.UserID up to message msg.MessageID (or msg.Time)
+// edited or deleted after it was sent, in the order of the changes. A reconnecting client has
+// missed those changes, it knows only the messages themselves.
+func (l *Logic) GetChangedMessages(ctx context.Context, msg *models.Message) ([]models.Message, error) {
+	ctx, span := tracer.Start(ctx, "Logic.GetChangedMessages")
+	defer span.End()
+	const changedAt = "GREATEST(m.edited_at, m.deleted_at)"
+	messages := make([]models.Message, 0)
+	q := l.db.NewSelect().
+		Model(&messages).
+		Relation("Attachments").
+		Where("m.user_id = ? OR m.to_id = ?", msg.UserID, msg.UserID)
+	if msg.MessageID != 0 {
+		since := l.db.NewSelect().
+			Model((*models.Message)(nil)).
+			Column("time").
+			Where("id = ?", msg.MessageID)
+		q = q.Where("m.id <= ?", msg.MessageID).
+			Where(changedAt+" > (?)", since)
+	} else {
+		q = q.Where("m.time <= ?", msg.Time).
+			Where(changedAt+" > ?", msg.Time)
+	}
+	err := q.OrderExpr(changedAt + " ASC").Scan(ctx)
 	if err != nil {
-		return fmt.Errorf("getting new messages: %w", err)
+		return nil, fmt.Errorf("select query: %w", err)
 	}
+	l.attachments.FillURLs(msg.UserID, messages)
+	return messages, nil
+}
 
-	for i := range messages {
-		jsonData, err := json.Marshal(messages[i])
-		if err != nil {
-			return fmt.Errorf("marshaling json: %w", err)
-		}
-		send(jsonData)
+// SendMessages replays the messages after msg.MessageID (or msg.Time) and then streams live
+// events of msg.UserID until ctx is done. It is shared by every transport, send writes one
+// event to the client. A client that can not keep up is disconnected with ErrDisconnected.
+func (l *Logic) SendMessages(ctx context.Context, send func(models.Event) error, msg *models.Message) error {
+	// subscribe before reading the history, so nothing is lost in between
+	sub := l.hub.Subscribe(msg.UserID, hub.Disconnect)
+	defer func() {
+		l.hub.Unsubscribe(sub)
+		// the request context is done by now
+		l.markOffline(context.Background(), msg.UserID)
+	}()
+	l.markOnline(ctx, msg.UserID)
+	presence := time.NewTicker(presenceInterval)
+	defer presence.Stop()
+	replayedID, err := l.replay(ctx, send, msg)
+	if err != nil {
+		return err
 	}
 
 	for {
 		select {
-		case message := <-l.clientCh[msg.UserID]:
-			jsonData, err := json.Marshal(message)
-			if err != nil {
-				return fmt.Errorf("marshaling json: %w", err)
+		case event := <-sub.Events():
+			// messages saved between subscribing and reading the history come twice
+			isMessage := event.Type == models.EventMessage || event.Type == models.EventMatch
+			if isMessage && event.Message.MessageID <= replayedID {
+				continue
+			}
+			if event.Message != nil {
+				// urls are signed for the user, and the message is shared with the other
+				// connections, so they are set on a copy
+				message := *event.Message
+				message.Attachments = slices.Clone(message.Attachments)
+				l.attachments.fillURLs(msg.UserID, &message)
+				event.Message = &message
+			}
+			if err = send(event); err != nil {
+				return fmt.Errorf("sending event: %w", err)
 			}
-			send(jsonData)
+			if isMessage && event.Message.ToID == msg.UserID && event.Message.DeliveredAt == nil {
+				l.markDelivered(ctx, msg.UserID, []int64{event.Message.MessageID})
+			}
+		case <-presence.C:
+			l.markOnline(ctx, msg.UserID)
+		case <-sub.Done():
+			return ErrDisconnected
+		case <-l.hub.Closed():
+			if err = send(models.Event{Type: models.EventGoingAway}); err != nil {
+				return fmt.Errorf("sending event: %w", err)
+			}
+			return ErrGoingAway
 		case <-ctx.Done():
-			l.mu.Lock()
-			delete(l.clientCh, msg.UserID)
-			l.mu.Unlock()
 			return nil
 		}
 	}
 }
 
+// replay sends the edits and deletions, then the messages the client has missed and returns the id
+// of the last message. It has a span of its own, SendMessages lives as long as the connection.
+func (l *Logic) replay(ctx context.Context, send func(models.Event) error, msg *models.Message) (int64, error) {
+	ctx, span := tracer.Start(ctx, "Logic.SendMessages.replay")
+	defer span.End()
+	changed, err := l.GetChangedMessages(ctx, msg)
+	if err != nil {
+		return 0, fmt.Errorf("getting changed messages: %w", err)
+	}
+	for i := range changed {
+		if err = send(changeEvent(&changed[i])); err != nil {
+			return 0, fmt.Errorf("sending event: %w", err)
+		}
+	}
+	messages, err := l.GetNewMessages(ctx, msg)
+	if err != nil {
+		return 0, fmt.Errorf("getting new messages: %w", err)
+	}
+	var (
+		replayedID int64
+		received   []int64
+	)
+	for i := range messages {
+		err = send(models.Event{
+			Type:    models.EventMessage,
+			Message: &messages[i],
+		})
+		if err != nil {
+			return 0, fmt.Errorf("sending event: %w", err)
+		}
+		replayedID = messages[i].MessageID
+		if messages[i].ToID == msg.UserID && messages[i].DeliveredAt == nil {
+			received = append(received, messages[i].MessageID)
+		}
+	}
+	l.markDelivered(ctx, msg.UserID, received)
+	return replayedID, nil
+}
+
 func (l *Logic) GetRecommendations(ctx context.Context, filter *models.Filter) ([]models.User, error) {
+	ctx, span := tracer.Start(ctx, "Logic.GetRecommendations")
+	defer span.End()
 	user := new(models.User)
 	err := l.db.NewSelect().
 		Model(user).
@@ -266,6 +553,7 @@ func (l *Logic) GetRecommendations(ctx context.Context, filter *models.Filter) (
 	users := make([]models.User, 0)
 	err = l.db.NewSelect().
 		Model(&users).
+		Relation("Photos", orderPhotos).
 		Where("id NOT IN (?)", bun.In(reactedUserIDs)).
 		Where("sex = ?", filter.Sex).
 		Where("EXTRACT(YEAR FROM AGE(CURRENT_TIMESTAMP, birthday)) BETWEEN ? AND ?", filter.MinAge, filter.MaxAge).
@@ -275,9 +563,13 @@ func (l *Logic) GetRecommendations(ctx context.Context, filter *models.Filter) (
 	if err != nil {
 		return nil, fmt.Errorf("users select query: %w", err)
 	}
+	for i := range users {
+		l.photos.FillURLs(users[i].Photos)
+		l.fillPresence(&users[i])
+	}
 	return users, nil
 }
 
-func (l *Logic) DeleteImg(imagePath string) error {
-	return os.Remove(imagePath)
+func orderPhotos(q *bun.SelectQuery) *bun.SelectQuery {
+	return q.Order("position ASC")
 }
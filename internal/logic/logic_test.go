@@ -2,14 +2,34 @@ package logic
 
 import (
 	"context"
+	"sparky-back/internal/hub"
 	"sparky-back/internal/loader"
 	"sparky-back/internal/models"
+	"sparky-back/internal/pubsub"
+	"sparky-back/pkg/blobstore"
+	"sparky-back/pkg/urlsign"
 	"testing"
+	"time"
 )
 
 func TestLogic_SetReaction(t *testing.T) {
-	logic := NewLogic(loader.New("localhost", 5432, "postgres", "123456", "sparky"))
-	err := logic.SetReaction(context.TODO(), &models.Reaction{
+	store, err := blobstore.NewLocal(blobstore.LocalConfig{Dir: t.TempDir()})
+	if err != nil {
+		panic(err)
+	}
+	db, err := loader.New(context.TODO(), loader.Config{
+		Host:     "localhost",
+		Port:     5432,
+		User:     "postgres",
+		Password: "123456",
+		DBName:   "sparky",
+	})
+	if err != nil {
+		panic(err)
+	}
+	h := hub.New(10)
+	logic := NewLogic(db, NewPhotoService(db, store, nil, true), NewAttachmentService(db, store, urlsign.New([]byte("secret"), time.Hour)), h, pubsub.NewLocal(h.Publish))
+	err = logic.SetReaction(context.TODO(), &models.Reaction{
 		UserID: 2,
 		ToID:   1,
 		Like:   true,
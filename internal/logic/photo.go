@@ -0,0 +1,408 @@
+package logic
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/uptrace/bun"
+	"io"
+	"path"
+	"regexp"
+	"sparky-back/internal/models"
+	"sparky-back/pkg/blobstore"
+	"sparky-back/pkg/imaging"
+	"sparky-back/pkg/urlsign"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxPhotos   = 6
+	orphanGrace = time.Hour
+	staticURL   = "/static/"
+	originalURL = "original"
+)
+
+var (
+	photoSizes  = []int{128, 512, 1080}
+	photoLimits = imaging.Limits{
+		MaxBytes:     10 << 20,
+		MaxDimension: 8000,
+		MaxPixels:    40_000_000,
+	}
+)
+
+var (
+	ErrTooManyPhotos = fmt.Errorf("user can not have more than %d photos", maxPhotos)
+	ErrPhotoNotFound = errors.New("photo not found")
+	ErrFileNotFound  = errors.New("file not found")
+	ErrFileForbidden = errors.New("file url is not signed or expired")
+)
+
+// imageKeyRe matches the keys saveImage generates, "<uuid>.jpg" or "<uuid>_<size>.jpg"
+var imageKeyRe = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}(_[0-9]+)?\.(jpg|png)$`)
+
+// PhotoService stores user photos: rows in the photos table and files in the blob store.
+// Unless photos are public, their urls are signed and expire.
+type PhotoService struct {
+	db     *bun.DB
+	store  blobstore.BlobStore
+	signer *urlsign.Signer
+	public bool
+}
+
+func NewPhotoService(db *bun.DB, store blobstore.BlobStore, signer *urlsign.Signer, public bool) *PhotoService {
+	return &PhotoService{
+		db:     db,
+		store:  store,
+		signer: signer,
+		public: public,
+	}
+}
+
+func (s *PhotoService) List(ctx context.Context, userID int64) ([]models.Photo, error) {
+	photos := make([]models.Photo, 0)
+	err := s.db.NewSelect().
+		Model(&photos).
+		Where("user_id = ?", userID).
+		Order("position ASC").
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select query: %w", err)
+	}
+	s.FillURLs(photos)
+	return photos, nil
+}
+
+// Add appends a photo to the end of the user's list. The first photo becomes the primary one.
+func (s *PhotoService) Add(ctx context.Context, userID int64, file io.Reader) (*models.Photo, error) {
+	var photo *models.Photo
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		var err error
+		photo, err = s.add(ctx, tx, userID, file)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return photo, nil
+}
+
+func (s *PhotoService) add(ctx context.Context, tx bun.Tx, userID int64, file io.Reader) (*models.Photo, error) {
+	if err := lockUser(ctx, tx, userID); err != nil {
+		return nil, err
+	}
+	count, err := tx.NewSelect().Model((*models.Photo)(nil)).Where("user_id = ?", userID).Count(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("count query: %w", err)
+	}
+	if count >= maxPhotos {
+		return nil, ErrTooManyPhotos
+	}
+	photo := &models.Photo{
+		UserID:    userID,
+		Position:  count,
+		IsPrimary: count == 0,
+	}
+	if err = s.saveImage(ctx, photo, file); err != nil {
+		return nil, fmt.Errorf("saving image: %w", err)
+	}
+	_, err = tx.NewInsert().Model(photo).Exec(ctx)
+	if err != nil {
+		s.deleteImage(ctx, photo)
+		return nil, fmt.Errorf("insert query: %w", err)
+	}
+	s.fillURLs(photo)
+	return photo, nil
+}
+
+// ReplacePrimary swaps the file of the primary photo, or adds the first photo if the user has none.
+func (s *PhotoService) ReplacePrimary(ctx context.Context, userID int64, file io.Reader) (*models.Photo, error) {
+	var (
+		photo    = new(models.Photo)
+		oldPhoto models.Photo
+	)
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockUser(ctx, tx, userID); err != nil {
+			return err
+		}
+		err := tx.NewSelect().Model(photo).Where("user_id = ?", userID).Where("is_primary").Scan(ctx)
+		if errors.Is(err, sql.ErrNoRows) {
+			photo, err = s.add(ctx, tx, userID, file)
+			return err
+		}
+		if err != nil {
+			return fmt.Errorf("select query: %w", err)
+		}
+		oldPhoto = *photo
+		if err = s.saveImage(ctx, photo, file); err != nil {
+			return fmt.Errorf("saving image: %w", err)
+		}
+		_, err = tx.NewUpdate().Model(photo).Column("path", "sizes").WherePK().Exec(ctx)
+		if err != nil {
+			s.deleteImage(ctx, photo)
+			return fmt.Errorf("update query: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if oldPhoto.Path != "" {
+		s.deleteImage(ctx, &oldPhoto)
+	}
+	s.fillURLs(photo)
+	return photo, nil
+}
+
+// Reorder sets the photo order to ids. It must list every photo of the user exactly once,
+// the first one becomes primary.
+func (s *PhotoService) Reorder(ctx context.Context, userID int64, ids []int64) ([]models.Photo, error) {
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockUser(ctx, tx, userID); err != nil {
+			return err
+		}
+		photos := make([]models.Photo, 0)
+		err := tx.NewSelect().Model(&photos).Where("user_id = ?", userID).Scan(ctx)
+		if err != nil {
+			return fmt.Errorf("select query: %w", err)
+		}
+		if len(ids) != len(photos) {
+			return fmt.Errorf("expected %d photo ids, got %d", len(photos), len(ids))
+		}
+		owned := make(map[int64]bool, len(photos))
+		for i := range photos {
+			owned[photos[i].ID] = true
+		}
+		for i, id := range ids {
+			if !owned[id] {
+				return fmt.Errorf("photo %d: %w", id, ErrPhotoNotFound)
+			}
+			delete(owned, id)
+			_, err = tx.NewUpdate().
+				Model((*models.Photo)(nil)).
+				Set("position = ?, is_primary = ?", i, i == 0).
+				Where("id = ?", id).
+				Exec(ctx)
+			if err != nil {
+				return fmt.Errorf("update query: %w", err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return s.List(ctx, userID)
+}
+
+// Delete removes the photo and its file and closes the gap in positions.
+func (s *PhotoService) Delete(ctx context.Context, userID, photoID int64) error {
+	photo := new(models.Photo)
+	err := s.db.RunInTx(ctx, nil, func(ctx context.Context, tx bun.Tx) error {
+		if err := lockUser(ctx, tx, userID); err != nil {
+			return err
+		}
+		res, err := tx.NewDelete().
+			Model(photo).
+			Where("id = ?", photoID).
+			Where("user_id = ?", userID).
+			Returning("*").
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("delete query: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrPhotoNotFound
+		}
+		_, err = tx.NewUpdate().
+			Model((*models.Photo)(nil)).
+			Set("position = position - 1").
+			Where("user_id = ?", userID).
+			Where("position > ?", photo.Position).
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("update positions query: %w", err)
+		}
+		_, err = tx.NewUpdate().
+			Model((*models.Photo)(nil)).
+			Set("is_primary = (position = 0)").
+			Where("user_id = ?", userID).
+			Exec(ctx)
+		if err != nil {
+			return fmt.Errorf("update primary query: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return s.deleteImage(ctx, photo)
+}
+
+// Open opens an image file created by the service and returns when its url expires,
+// zero time for public photos. Keys of photos uploaded before images were re-encoded
+// are free-form, so they are only accepted if a photo still refers to them.
+// The caller must close the returned object.
+func (s *PhotoService) Open(ctx context.Context, key, expires, sig string) (*blobstore.Object, time.Time, error) {
+	var expiresAt time.Time
+	if !s.public {
+		var err error
+		expiresAt, err = s.signer.Verify(staticURL+key, expires, sig)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("%w: %w", ErrFileForbidden, err)
+		}
+	}
+	if !imageKeyRe.MatchString(key) {
+		legacy, err := s.db.NewSelect().
+			Model((*models.Photo)(nil)).
+			Where("path = ?", key).
+			Where("sizes IS NULL").
+			Exists(ctx)
+		if err != nil {
+			return nil, time.Time{}, fmt.Errorf("select query: %w", err)
+		}
+		if !legacy {
+			return nil, time.Time{}, ErrFileNotFound
+		}
+	}
+	obj, err := s.store.Get(ctx, key)
+	if errors.Is(err, blobstore.ErrNotExist) || errors.Is(err, blobstore.ErrInvalidKey) {
+		return nil, time.Time{}, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("getting blob: %w", err)
+	}
+	return obj, expiresAt, nil
+}
+
+// CleanOrphans removes files in the blob store that neither a photo nor keep refers to.
+// Files younger than orphanGrace are kept, they may belong to an upload in progress.
+func (s *PhotoService) CleanOrphans(ctx context.Context, keep ...string) (int, error) {
+	infos, err := s.store.List(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("listing blobs: %w", err)
+	}
+	photos := make([]models.Photo, 0)
+	err = s.db.NewSelect().Model(&photos).Column("path", "sizes").Scan(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("select query: %w", err)
+	}
+	used := make(map[string]bool, len(photos)+len(keep))
+	for _, key := range keep {
+		used[key] = true
+	}
+	for i := range photos {
+		for _, key := range photoKeys(&photos[i]) {
+			used[key] = true
+		}
+	}
+	removed := 0
+	for _, info := range infos {
+		if used[info.Key] || time.Since(info.ModTime) < orphanGrace {
+			continue
+		}
+		if err = s.store.Delete(ctx, info.Key); err != nil {
+			return removed, fmt.Errorf("removing file: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (s *PhotoService) FillURLs(photos []models.Photo) {
+	for i := range photos {
+		s.fillURLs(&photos[i])
+	}
+}
+
+// fillURLs sets a url for every size. Photos uploaded before thumbnails existed
+// have no sizes, their original is used instead.
+func (s *PhotoService) fillURLs(photo *models.Photo) {
+	photo.URL = s.url(photo.Path)
+	photo.URLs = map[string]string{
+		originalURL: photo.URL,
+	}
+	for _, size := range photoSizes {
+		photo.URLs[strconv.Itoa(size)] = photo.URL
+	}
+	for _, size := range photo.Sizes {
+		photo.URLs[strconv.Itoa(size)] = s.url(thumbnailKey(photo.Path, size))
+	}
+}
+
+func (s *PhotoService) url(key string) string {
+	if s.public {
+		return staticURL + key
+	}
+	return s.signer.Sign(staticURL + key)
+}
+
+// saveImage validates and re-encodes the upload, stores it with all thumbnails and
+// sets the photo path and sizes.
+func (s *PhotoService) saveImage(ctx context.Context, photo *models.Photo, file io.Reader) error {
+	res, err := imaging.Process(file, photoLimits, photoSizes)
+	if err != nil {
+		return fmt.Errorf("processing image: %w", err)
+	}
+	saved := &models.Photo{
+		Path: uuid.New().String() + res.Original.Ext,
+	}
+	err = s.store.Put(ctx, saved.Path, bytes.NewReader(res.Original.Data), int64(len(res.Original.Data)), res.Original.ContentType)
+	if err != nil {
+		return fmt.Errorf("storing original: %w", err)
+	}
+	for _, size := range photoSizes {
+		thumb := res.Thumbnails[size]
+		err = s.store.Put(ctx, thumbnailKey(saved.Path, size), bytes.NewReader(thumb.Data), int64(len(thumb.Data)), thumb.ContentType)
+		if err != nil {
+			s.deleteImage(ctx, saved)
+			return fmt.Errorf("storing %d thumbnail: %w", size, err)
+		}
+		saved.Sizes = append(saved.Sizes, size)
+	}
+	photo.Path, photo.Sizes = saved.Path, saved.Sizes
+	return nil
+}
+
+func (s *PhotoService) deleteImage(ctx context.Context, photo *models.Photo) error {
+	for _, key := range photoKeys(photo) {
+		if err := s.store.Delete(ctx, key); err != nil {
+			return fmt.Errorf("removing file: %w", err)
+		}
+	}
+	return nil
+}
+
+func photoKeys(photo *models.Photo) []string {
+	keys := []string{photo.Path}
+	for _, size := range photo.Sizes {
+		keys = append(keys, thumbnailKey(photo.Path, size))
+	}
+	return keys
+}
+
+// thumbnailKey turns "<id>.jpg" into "<id>_128.jpg".
+func thumbnailKey(key string, size int) string {
+	ext := path.Ext(key)
+	return strings.TrimSuffix(key, ext) + "_" + strconv.Itoa(size) + ext
+}
+
+// lockUser serializes photo changes of one user for the rest of the transaction.
+func lockUser(ctx context.Context, tx bun.Tx, userID int64) error {
+	var id int64
+	err := tx.NewSelect().
+		Model((*models.User)(nil)).
+		Column("id").
+		Where("id = ?", userID).
+		For("UPDATE").
+		Scan(ctx, &id)
+	if err != nil {
+		return fmt.Errorf("lock user %d: %w", userID, err)
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package logic
+
+import "testing"
+
+func TestThumbnailKey(t *testing.T) {
+	tests := []struct {
+		key  string
+		size int
+		want string
+	}{
+		{"0b6f6c1e-2a6b-4c1e-9a4e-1f2d3c4b5a69.jpg", 128, "0b6f6c1e-2a6b-4c1e-9a4e-1f2d3c4b5a69_128.jpg"},
+		{"att_0b6f6c1e-2a6b-4c1e-9a4e-1f2d3c4b5a69.png", 256, "att_0b6f6c1e-2a6b-4c1e-9a4e-1f2d3c4b5a69_256.png"},
+		{"legacy", 512, "legacy_512"},
+	}
+	for _, tt := range tests {
+		if got := thumbnailKey(tt.key, tt.size); got != tt.want {
+			t.Errorf("thumbnailKey(%q, %d) = %q, want %q", tt.key, tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestImageKeyRe(t *testing.T) {
+	tests := []struct {
+		key  string
+		want bool
+	}{
+		{"0b6f6c1e-2a6b-4c1e-9a4e-1f2d3c4b5a69.jpg", true},
+		{"0b6f6c1e-2a6b-4c1e-9a4e-1f2d3c4b5a69_1080.png", true},
+		// attachments are served only by /attachment
+		{"att_0b6f6c1e-2a6b-4c1e-9a4e-1f2d3c4b5a69.jpg", false},
+		{"0b6f6c1e-2a6b-4c1e-9a4e-1f2d3c4b5a69.gif", false},
+		{"0B6F6C1E-2A6B-4C1E-9A4E-1F2D3C4B5A69.jpg", false},
+		{"../0b6f6c1e-2a6b-4c1e-9a4e-1f2d3c4b5a69.jpg", false},
+		{"avatar.jpg", false},
+	}
+	for _, tt := range tests {
+		if got := imageKeyRe.MatchString(tt.key); got != tt.want {
+			t.Errorf("imageKeyRe.MatchString(%q) = %v, want %v", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package logic
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sparky-back/internal/models"
+	"sparky-back/pkg/zaplogger"
+	"time"
+)
+
+// presenceInterval is how often a live connection refreshes online_until. Users connected
+// to other instances count as online until it passes.
+const presenceInterval = time.Minute
+
+var ErrNotMatched = errors.New("users are not matched")
+
+// SetPresenceHidden sets whether the user's online state and last seen time are shown to others.
+func (l *Logic) SetPresenceHidden(ctx context.Context, userID int64, hidden bool) error {
+	ctx, span := tracer.Start(ctx, "Logic.SetPresenceHidden")
+	defer span.End()
+	_, err := l.db.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("hide_presence = ?", hidden).
+		Where("id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("update query: %w", err)
+	}
+	return nil
+}
+
+// Typing tells toID that userID is typing. It is not saved, and only matched users may send it.
+func (l *Logic) Typing(ctx context.Context, userID, toID int64) error {
+	ctx, span := tracer.Start(ctx, "Logic.Typing")
+	defer span.End()
+	matched, err := l.matched(ctx, userID, toID)
+	if err != nil {
+		return err
+	}
+	if !matched {
+		return ErrNotMatched
+	}
+	l.deliver(ctx, toID, models.Event{
+		Type:   models.EventTyping,
+		UserID: userID,
+		ToID:   toID,
+	})
+	return nil
+}
+
+func (l *Logic) matched(ctx context.Context, userID, toID int64) (bool, error) {
+	likes, err := l.db.NewSelect().
+		Model((*models.Reaction)(nil)).
+		Where("(user_id = ? AND to_id = ?) OR (user_id = ? AND to_id = ?)", userID, toID, toID, userID).
+		Where(`r."like"`).
+		Count(ctx)
+	if err != nil {
+		return false, fmt.Errorf("count reactions query: %w", err)
+	}
+	return likes == 2, nil
+}
+
+// markOnline is called by live connections every presenceInterval. It is best effort,
+// a failure only makes the user look offline on other instances.
+func (l *Logic) markOnline(ctx context.Context, userID int64) {
+	now := time.Now()
+	l.updatePresence(ctx, userID, now, now.Add(2*presenceInterval))
+}
+
+// markOffline records when the user was last seen. The online mark is cleared by the last
+// connection of the instance, connections on other instances set it again on their next tick.
+func (l *Logic) markOffline(ctx context.Context, userID int64) {
+	var onlineUntil any
+	if l.hub.Connections(userID) > 0 {
+		onlineUntil = time.Now().Add(2 * presenceInterval)
+	}
+	l.updatePresence(ctx, userID, time.Now(), onlineUntil)
+}
+
+func (l *Logic) updatePresence(ctx context.Context, userID int64, lastSeen time.Time, onlineUntil any) {
+	_, err := l.db.NewUpdate().
+		Model((*models.User)(nil)).
+		Set("last_seen_at = ?", lastSeen).
+		Set("online_until = ?", onlineUntil).
+		Where("id = ?", userID).
+		Exec(ctx)
+	if err != nil {
+		zaplogger.FromContext(ctx).With("user_id", userID).Error(fmt.Errorf("updating presence: %w", err))
+	}
+}
+
+// fillPresence sets whether the user is online, or clears last seen if the user hides it.
+// Last seen only tells when the user was last seen, online means a live connection.
+func (l *Logic) fillPresence(user *models.User) {
+	if user.HidePresence {
+		user.Online, user.LastSeenAt = false, nil
+		return
+	}
+	user.Online = l.hub.Connections(user.ID) > 0 ||
+		user.OnlineUntil != nil && time.Now().Before(*user.OnlineUntil)
+}
@@ -0,0 +1,45 @@
+package logic
+
+import (
+	"sparky-back/internal/hub"
+	"sparky-back/internal/models"
+	"testing"
+	"time"
+)
+
+func TestLogic_FillPresence(t *testing.T) {
+	h := hub.New(1)
+	l := &Logic{hub: h}
+	now := time.Now()
+	later := now.Add(time.Minute)
+	earlier := now.Add(-time.Second)
+	tests := []struct {
+		name       string
+		user       models.User
+		connected  bool
+		wantOnline bool
+	}{
+		// the disconnect sets last seen, it must not count as online
+		{name: "just left", user: models.User{ID: 1, LastSeenAt: &now}},
+		{name: "expired mark", user: models.User{ID: 1, LastSeenAt: &earlier, OnlineUntil: &earlier}},
+		{name: "other instance", user: models.User{ID: 1, LastSeenAt: &now, OnlineUntil: &later}, wantOnline: true},
+		{name: "this instance", user: models.User{ID: 1}, connected: true, wantOnline: true},
+		{name: "hidden", user: models.User{ID: 1, HidePresence: true, LastSeenAt: &now, OnlineUntil: &later}, connected: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.connected {
+				sub := h.Subscribe(tt.user.ID, hub.Drop)
+				defer h.Unsubscribe(sub)
+			}
+			user := tt.user
+			l.fillPresence(&user)
+			if user.Online != tt.wantOnline {
+				t.Errorf("got online %v, want %v", user.Online, tt.wantOnline)
+			}
+			if user.HidePresence && user.LastSeenAt != nil {
+				t.Error("got last seen of a user hiding it")
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"github.com/uptrace/bun"
+	"sparky-back/internal/models"
+	"sparky-back/pkg/zaplogger"
+	"time"
+)
+
+// MarkRead marks the messages partnerID sent to userID up to messageID as read and
+// tells both users about it.
+func (l *Logic) MarkRead(ctx context.Context, userID, partnerID, messageID int64) error {
+	ctx, span := tracer.Start(ctx, "Logic.MarkRead")
+	defer span.End()
+	now := time.Now()
+	res, err := l.db.NewUpdate().
+		Model((*models.Message)(nil)).
+		Set("read_at = ?", now).
+		Set("delivered_at = COALESCE(delivered_at, ?)", now).
+		Where("to_id = ?", userID).
+		Where("user_id = ?", partnerID).
+		Where("id <= ?", messageID).
+		Where("read_at IS NULL").
+		Exec(ctx)
+	if err != nil {
+		return fmt.Errorf("update query: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil
+	}
+	event := models.Event{
+		Type:      models.EventRead,
+		UserID:    userID,
+		ToID:      partnerID,
+		MessageID: messageID,
+	}
+	l.deliver(ctx, partnerID, event)
+	// other devices of the reader update their unread counters
+	l.deliver(ctx, userID, event)
+	return nil
+}
+
+// markDelivered marks the messages userID has just got as delivered and tells every sender
+// the last delivered message. Receipts are best effort, so errors are only logged.
+func (l *Logic) markDelivered(ctx context.Context, userID int64, ids []int64) {
+	if len(ids) == 0 {
+		return
+	}
+	var delivered []struct {
+		ID     int64 `bun:"id"`
+		UserID int64 `bun:"user_id"`
+	}
+	_, err := l.db.NewUpdate().
+		Model((*models.Message)(nil)).
+		Set("delivered_at = ?", time.Now()).
+		Where("id IN (?)", bun.In(ids)).
+		Where("to_id = ?", userID).
+		Where("delivered_at IS NULL").
+		Returning("id, user_id").
+		Exec(ctx, &delivered)
+	if err != nil {
+		zaplogger.FromContext(ctx).With("user_id", userID).Error(fmt.Errorf("marking messages delivered: %w", err))
+		return
+	}
+	lastIDs := make(map[int64]int64)
+	for _, msg := range delivered {
+		lastIDs[msg.UserID] = max(lastIDs[msg.UserID], msg.ID)
+	}
+	for senderID, messageID := range lastIDs {
+		l.deliver(ctx, senderID, models.Event{
+			Type:      models.EventDelivered,
+			UserID:    userID,
+			ToID:      senderID,
+			MessageID: messageID,
+		})
+	}
+}
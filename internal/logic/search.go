@@ -0,0 +1,93 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"github.com/uptrace/bun"
+	"html"
+	"sparky-back/internal/models"
+	"strings"
+)
+
+const (
+	// searchConfig does no stemming, so messages in any language are found by whole words
+	searchConfig = "simple"
+	// ts_headline marks matches with these private use characters, they are not typed
+	// in practice and survive html escaping
+	snippetStart = "\ue000"
+	snippetStop  = "\ue001"
+)
+
+var snippetReplacer = strings.NewReplacer(snippetStart, "<b>", snippetStop, "</b>")
+
+// SearchMessages finds the messages the user sent or got matching the query, newest first.
+func (l *Logic) SearchMessages(ctx context.Context, search *models.SearchQuery) ([]models.SearchResult, error) {
+	ctx, span := tracer.Start(ctx, "Logic.SearchMessages")
+	defer span.End()
+	limit := search.Limit
+	if limit <= 0 {
+		limit = defaultPageLimit
+	}
+	limit = min(limit, maxPageLimit)
+
+	var rows []struct {
+		models.Message `bun:",extend"`
+		Snippet        string `bun:"snippet,scanonly"`
+	}
+	headlineOptions := fmt.Sprintf(`StartSel="%s", StopSel="%s", MaxFragments=2`, snippetStart, snippetStop)
+	q := l.db.NewSelect().
+		Model(&rows).
+		ColumnExpr("?TableColumns").
+		ColumnExpr("ts_headline(?, m.text, websearch_to_tsquery(?, ?), ?) AS snippet",
+			searchConfig, searchConfig, search.Query, headlineOptions).
+		Where("m.user_id = ? OR m.to_id = ?", search.UserID, search.UserID).
+		Where("m.search @@ websearch_to_tsquery(?, ?)", searchConfig, search.Query).
+		Where("m.deleted_at IS NULL").
+		Order("m.id DESC").
+		Limit(limit)
+	if search.Before != 0 {
+		q = q.Where("m.id < ?", search.Before)
+	}
+	if err := q.Scan(ctx); err != nil {
+		return nil, fmt.Errorf("select query: %w", err)
+	}
+
+	// the search rows can not have relations, attachments are loaded by the message ids
+	ids := make([]int64, 0, len(rows))
+	byID := make(map[int64]int, len(rows))
+	for i, row := range rows {
+		ids = append(ids, row.MessageID)
+		byID[row.MessageID] = i
+	}
+	attachments := make([]models.Attachment, 0)
+	if len(ids) > 0 {
+		err := l.db.NewSelect().
+			Model(&attachments).
+			Where("a.message_id IN (?)", bun.In(ids)).
+			Order("a.id ASC").
+			Scan(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("attachments select query: %w", err)
+		}
+	}
+	for _, attachment := range attachments {
+		row := &rows[byID[attachment.MessageID]]
+		row.Attachments = append(row.Attachments, attachment)
+	}
+
+	results := make([]models.SearchResult, 0, len(rows))
+	for _, row := range rows {
+		l.attachments.fillURLs(search.UserID, &row.Message)
+		partnerID := row.ToID
+		if row.ToID == search.UserID {
+			partnerID = row.UserID
+		}
+		results = append(results, models.SearchResult{
+			PartnerID: partnerID,
+			Message:   row.Message,
+			Snippet:   snippetReplacer.Replace(html.EscapeString(row.Snippet)),
+			Before:    row.MessageID + 1,
+		})
+	}
+	return results, nil
+}
@@ -0,0 +1,6 @@
+package logic
+
+import "go.opentelemetry.io/otel"
+
+// tracer starts a span for every exported Logic method, queries add their own spans below it.
+var tracer = otel.Tracer("sparky-back/internal/logic")
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/uptrace/bun"
+	"time"
+)
+
+// QueryHook records the duration of every bun query.
+type QueryHook struct{}
+
+var _ bun.QueryHook = QueryHook{}
+
+func (QueryHook) BeforeQuery(ctx context.Context, _ *bun.QueryEvent) context.Context {
+	return ctx
+}
+
+func (QueryHook) AfterQuery(_ context.Context, event *bun.QueryEvent) {
+	result := "ok"
+	if event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows) {
+		result = "error"
+	}
+	DBQueryDuration.WithLabelValues(event.Operation(), result).Observe(time.Since(event.StartTime).Seconds())
+}
@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+)
+
+const namespace = "sparky"
+
+var (
+	HTTPRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template and status code.",
+	}, []string{"method", "route", "status"})
+	HTTPDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and status code, streams count until they end.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+	Panics = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_panics_total",
+		Help:      "Panics recovered in HTTP handlers.",
+	})
+	DBQueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "db_query_duration_seconds",
+		Help:      "Database query latency by operation and result.",
+		Buckets:   []float64{.0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5},
+	}, []string{"operation", "result"})
+	Matches = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "matches_total",
+		Help:      "Mutual likes.",
+	})
+	UploadSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upload_size_bytes",
+		Help:      "Sizes of uploaded files before processing.",
+		Buckets:   prometheus.ExponentialBuckets(16<<10, 2, 10),
+	}, []string{"kind"})
+)
+
+// ChatStats is implemented by hub.Hub.
+type ChatStats interface {
+	Count() int
+	Dropped() int64
+}
+
+// RegisterChat exposes the live chat connections and the events they lost.
+func RegisterChat(stats ChatStats) {
+	promauto.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "chat_connections",
+		Help:      "Live chat connections of this instance.",
+	}, func() float64 {
+		return float64(stats.Count())
+	})
+	promauto.NewCounterFunc(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "chat_dropped_events_total",
+		Help:      "Events lost by slow chat connections.",
+	}, func() float64 {
+		return float64(stats.Dropped())
+	})
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
@@ -1,23 +1,88 @@
 package middlewares
 
 import (
+	"github.com/google/uuid"
 	"github.com/uptrace/bunrouter"
-	"go.uber.org/zap"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
+	"sparky-back/internal/httperr"
+	"sparky-back/pkg/recorder"
+	"sparky-back/pkg/zaplogger"
+	"time"
 )
 
+const (
+	requestIDHeader = "X-Request-ID"
+	maxRequestIDLen = 128
+)
+
+// Log gives every request an id, taken from X-Request-ID if the caller sent one, and puts
+// a logger with it into the request context. The end of the request is logged with the status,
+// the bytes written, the time to first byte and the duration.
+// It must run after Tracing to log the trace id.
 func Log(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
 	return func(w http.ResponseWriter, req bunrouter.Request) error {
-		zap.S().With("path", req.RequestURI).With("remote_addr", req.RemoteAddr).Info("start request")
-		//rec := recorder.NewResponseRecorder(w)
-		err := next(w, req)
-		//TODO
+		start := time.Now()
+		requestID := req.Header.Get(requestIDHeader)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+		w.Header().Set(requestIDHeader, requestID)
+
+		logger := zaplogger.FromContext(req.Context()).With(
+			"request_id", requestID,
+			"method", req.Method,
+			"route", req.Route(),
+			"path", req.URL.Path,
+			"remote_addr", req.RemoteAddr,
+		)
+		if span := trace.SpanContextFromContext(req.Context()); span.IsValid() {
+			logger = logger.With("trace_id", span.TraceID().String())
+		}
+		logger.Debug("start request")
+
+		rec := recorder.NewResponseRecorder(w)
+		// WithContext copies the request, the handler parses the form of the copy
+		inner := req.WithContext(zaplogger.WithLogger(req.Context(), logger))
+		err := next(rec, inner)
+		if err != nil && rec.IsDefault() {
+			rec.WriteHeader(httperr.Status(err))
+		}
+
+		// handlers have parsed the form by now, streams only read the query
+		form := inner.Form
+		if form == nil {
+			form = req.URL.Query()
+		}
+		logger = logger.With(
+			"status", rec.StatusCode(),
+			"bytes", rec.Bytes,
+			"duration", time.Since(start),
+		)
+		if !rec.FirstWrite.IsZero() {
+			logger = logger.With("ttfb", rec.FirstWrite.Sub(start))
+		}
+		if userID := form.Get("user_id"); userID != "" {
+			logger = logger.With("user_id", userID)
+		}
 		if err != nil {
-			zap.S().With("path", req.RequestURI).With("remote_addr", req.RemoteAddr).Error(err)
-			w.WriteHeader(http.StatusBadRequest)
+			logger.Error(err)
 		} else {
-			zap.S().With("path", req.RequestURI).With("remote_addr", req.RemoteAddr).Info("end request")
+			logger.Info("end request")
 		}
 		return err
 	}
 }
+
+// validRequestID keeps ids from callers short and printable, they go into logs as is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"bytes"
+	"github.com/uptrace/bunrouter"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"sparky-back/pkg/zaplogger"
+	"testing"
+)
+
+func TestLog_RequestID(t *testing.T) {
+	var (
+		flushable bool
+		hasLogger bool
+	)
+	router := bunrouter.New(bunrouter.Use(Log))
+	router.GET("/connection", func(w http.ResponseWriter, req bunrouter.Request) error {
+		_, flushable = w.(http.Flusher)
+		hasLogger = zaplogger.FromContext(req.Context()) != zap.S()
+		return nil
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/connection", nil)
+	req.Header.Set(requestIDHeader, "abc-123")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(requestIDHeader); got != "abc-123" {
+		t.Errorf("got request id %q, want the one sent, abc-123", got)
+	}
+	if !flushable {
+		t.Error("handler lost http.Flusher")
+	}
+	if !hasLogger {
+		t.Error("handler got the global logger, not the request one")
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/connection", nil)
+	req.Header.Set(requestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get(requestIDHeader); got == "" || got == "bad id\n" {
+		t.Errorf("got request id %q, want a generated one", got)
+	}
+}
+
+func TestLog_UserID(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	defer zap.ReplaceGlobals(zap.New(core))()
+	router := bunrouter.New(bunrouter.Use(Log))
+	router.POST("/message", func(w http.ResponseWriter, req bunrouter.Request) error {
+		return req.ParseMultipartForm(1 << 20)
+	})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	if err := form.WriteField("user_id", "42"); err != nil {
+		t.Fatal(err)
+	}
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/message", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	entries := logs.FilterMessage("end request").All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d end request entries, want 1", len(entries))
+	}
+	if got := entries[0].ContextMap()["user_id"]; got != "42" {
+		t.Errorf("got user_id %v, want 42", got)
+	}
+}
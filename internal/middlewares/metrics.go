@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"sparky-back/internal/metrics"
+	"sparky-back/pkg/recorder"
+	"strconv"
+	"time"
+)
+
+// Metrics counts requests by route template, so /conversations/7/messages and
+// /conversations/8/messages share a label. It must run before Log to see the status
+// Log writes for errors.
+func Metrics(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		start := time.Now()
+		rec := recorder.NewResponseRecorder(w)
+		err := next(rec, req)
+		status := strconv.Itoa(rec.StatusCode())
+		metrics.HTTPRequests.WithLabelValues(req.Method, req.Route(), status).Inc()
+		metrics.HTTPDuration.WithLabelValues(req.Method, req.Route(), status).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"net/http/httptest"
+	"sparky-back/internal/metrics"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	router := bunrouter.New(bunrouter.Use(Metrics, Log))
+	router.GET("/conversations/:id/messages", func(w http.ResponseWriter, req bunrouter.Request) error {
+		w.WriteHeader(http.StatusCreated)
+		return nil
+	})
+	router.GET("/user", func(w http.ResponseWriter, req bunrouter.Request) error {
+		return errors.New("no user_id")
+	})
+	tests := []struct {
+		path   string
+		route  string
+		status string
+	}{
+		{path: "/conversations/7/messages", route: "/conversations/:id/messages", status: "201"},
+		{path: "/conversations/8/messages", route: "/conversations/:id/messages", status: "201"},
+		// the status Log writes for the error
+		{path: "/user", route: "/user", status: "400"},
+	}
+	for _, tt := range tests {
+		counter := metrics.HTTPRequests.WithLabelValues(http.MethodGet, tt.route, tt.status)
+		before := testutil.ToFloat64(counter)
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tt.path, nil))
+		if got := testutil.ToFloat64(counter); got != before+1 {
+			t.Errorf("%s: got %v requests of %s with %s, want %v", tt.path, got, tt.route, tt.status, before+1)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"runtime/debug"
+	"sparky-back/internal/metrics"
+	"sparky-back/pkg/recorder"
+	"sparky-back/pkg/zaplogger"
+)
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Recover turns a panic in a handler into a 500 response and logs it with the stack.
+// It must run after Log, so the log has the request id.
+func Recover(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) (err error) {
+		rec := recorder.NewResponseRecorder(w)
+		defer func() {
+			p := recover()
+			if p == nil {
+				return
+			}
+			if p == http.ErrAbortHandler {
+				// net/http aborts the response quietly
+				panic(p)
+			}
+			metrics.Panics.Inc()
+			zaplogger.FromContext(req.Context()).
+				With("panic", fmt.Sprint(p)).
+				With("stack", string(debug.Stack())).
+				Error("handler panicked")
+			if !rec.IsDefault() {
+				// the client got a part of the response already, nothing to fix
+				err = nil
+				return
+			}
+			body, _ := json.Marshal(errorResponse{Error: http.StatusText(http.StatusInternalServerError)})
+			rec.Header().Set("Content-Type", "application/json")
+			rec.WriteHeader(http.StatusInternalServerError)
+			rec.Write(body)
+			err = nil
+		}()
+		return next(rec, req)
+	}
+}
@@ -0,0 +1,33 @@
+package middlewares
+
+import (
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/uptrace/bunrouter"
+	"net/http"
+	"net/http/httptest"
+	"sparky-back/internal/metrics"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	router := bunrouter.New(bunrouter.Use(Log, Recover))
+	router.GET("/user", func(w http.ResponseWriter, req bunrouter.Request) error {
+		var user *struct{ ID int64 }
+		_ = user.ID
+		return nil
+	})
+	panics := testutil.ToFloat64(metrics.Panics)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/user", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("got status %d, want 500", rec.Code)
+	}
+	if got := rec.Body.String(); got != `{"error":"Internal Server Error"}` {
+		t.Errorf("got body %s, want a json error", got)
+	}
+	if got := testutil.ToFloat64(metrics.Panics); got != panics+1 {
+		t.Errorf("got %v panics, want %v", got, panics+1)
+	}
+}
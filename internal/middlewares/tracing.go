@@ -0,0 +1,40 @@
+package middlewares
+
+import (
+	"github.com/uptrace/bunrouter"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"sparky-back/pkg/recorder"
+)
+
+var tracer = otel.Tracer("sparky-back/internal/middlewares")
+
+// Tracing starts the server span of the request, continuing the trace of the caller
+// if it sent a traceparent header. Handlers get the span in the request context.
+func Tracing(next bunrouter.HandlerFunc) bunrouter.HandlerFunc {
+	return func(w http.ResponseWriter, req bunrouter.Request) error {
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		ctx, span := tracer.Start(ctx, req.Method+" "+req.Route(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethod(req.Method),
+				semconv.HTTPRoute(req.Route()),
+				semconv.URLPath(req.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := recorder.NewResponseRecorder(w)
+		err := next(rec, req.WithContext(ctx))
+		span.SetAttributes(semconv.HTTPStatusCode(rec.StatusCode()))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
@@ -16,8 +16,25 @@ type User struct {
 	Sex           bool       `bun:"sex" json:"sex"`
 	Latitude      float64    `bun:"latitude" json:"latitude"`
 	Longitude     float64    `bun:"longitude" json:"longitude"`
-	ImgPath       string     `bun:"img_path" json:"img_path"`
-	Reactions     []Reaction `bun:"rel:has-many,join:id=user_id"`
+	HidePresence  bool       `bun:"hide_presence,notnull,default:false" json:"hide_presence"`
+	LastSeenAt    *time.Time `bun:"last_seen_at" json:"last_seen_at"`
+	// OnlineUntil is refreshed by live connections, it expires if an instance dies with them
+	OnlineUntil *time.Time `bun:"online_until" json:"-"`
+	Online      bool       `bun:"-" json:"online"`
+	Photos      []Photo    `bun:"rel:has-many,join:id=user_id" json:"photos"`
+	Reactions   []Reaction `bun:"rel:has-many,join:id=user_id"`
+}
+
+type Photo struct {
+	bun.BaseModel `bun:"table:photos,alias:p"`
+	ID            int64             `bun:"id,pk,autoincrement" json:"id"`
+	UserID        int64             `bun:"user_id,notnull" json:"user_id"`
+	Path          string            `bun:"path,notnull" json:"-"`
+	Position      int               `bun:"position,notnull" json:"position"`
+	IsPrimary     bool              `bun:"is_primary,notnull,default:false" json:"primary"`
+	Sizes         []int             `bun:"sizes,array" json:"-"`
+	URL           string            `bun:"-" json:"url"`
+	URLs          map[string]string `bun:"-" json:"urls"`
 }
 
 type Reaction struct {
@@ -28,13 +45,109 @@ type Reaction struct {
 	Like          bool  `bun:"like,default:false" json:"like"`
 }
 
+// Message is a chat message. A deleted message stays as a tombstone with DeletedAt set
+// and no text, its attachments are kept for moderation but not shown to the users.
 type Message struct {
 	bun.BaseModel `bun:"table:messages,alias:m"`
-	MessageID     int64     `bun:"id,pk,autoincrement" json:"id"`
-	UserID        int64     `json:"user_id"`
-	ToID          int64     `json:"to_id"`
-	Time          time.Time `bun:"time" json:"time"`
+	MessageID     int64        `bun:"id,pk,autoincrement" json:"id"`
+	UserID        int64        `json:"user_id"`
+	ToID          int64        `json:"to_id"`
+	ClientID      string       `bun:"client_id,nullzero" json:"client_id,omitempty"`
+	Time          time.Time    `bun:"time" json:"time"`
+	Text          string       `bun:"text" json:"text"`
+	DeliveredAt   *time.Time   `bun:"delivered_at" json:"delivered_at"`
+	ReadAt        *time.Time   `bun:"read_at" json:"read_at"`
+	EditedAt      *time.Time   `bun:"edited_at" json:"edited_at"`
+	DeletedAt     *time.Time   `bun:"deleted_at" json:"deleted_at"`
+	Attachments   []Attachment `bun:"rel:has-many,join:id=message_id" json:"attachments,omitempty"`
+}
+
+const (
+	AttachmentImage = "image"
+	AttachmentVoice = "voice"
+)
+
+// Attachment is a file sent with a message, only the two users of the conversation can get it.
+type Attachment struct {
+	bun.BaseModel `bun:"table:attachments,alias:a"`
+	ID            int64             `bun:"id,pk,autoincrement" json:"id"`
+	MessageID     int64             `bun:"message_id" json:"message_id"`
+	Kind          string            `bun:"kind" json:"kind"`
+	Path          string            `bun:"path" json:"-"`
+	ContentType   string            `bun:"content_type" json:"content_type"`
+	Size          int64             `bun:"size" json:"size"`
+	Sizes         []int             `bun:"sizes,array" json:"-"`
+	URL           string            `bun:"-" json:"url"`
+	URLs          map[string]string `bun:"-" json:"urls,omitempty"`
+}
+
+// MessageEdit keeps the text a message had before an edit or a deletion, for moderation.
+type MessageEdit struct {
+	bun.BaseModel `bun:"table:message_edits,alias:me"`
+	ID            int64     `bun:"id,pk,autoincrement" json:"id"`
+	MessageID     int64     `bun:"message_id" json:"message_id"`
 	Text          string    `bun:"text" json:"text"`
+	EditedAt      time.Time `bun:"edited_at" json:"edited_at"`
+}
+
+type Conversation struct {
+	PartnerID   int64   `json:"partner_id"`
+	LastMessage Message `json:"last_message"`
+	UnreadCount int     `json:"unread_count"`
+}
+
+// Page selects messages of a conversation before or after a message id,
+// the latest ones if neither is set.
+type Page struct {
+	UserID    int64 `json:"user_id"`
+	PartnerID int64 `json:"partner_id"`
+	Before    int64 `json:"before"`
+	After     int64 `json:"after"`
+	Limit     int   `json:"limit"`
+}
+
+// SearchQuery looks for messages of the user matching Query, older than Before if it is set.
+type SearchQuery struct {
+	UserID int64  `json:"user_id"`
+	Query  string `json:"query"`
+	Before int64  `json:"before"`
+	Limit  int    `json:"limit"`
+}
+
+// SearchResult is a found message with the matches in Snippet wrapped in <b> tags.
+// The conversation page that ends with the message is loaded with Before as the cursor.
+type SearchResult struct {
+	PartnerID int64   `json:"partner_id"`
+	Message   Message `json:"message"`
+	Snippet   string  `json:"snippet"`
+	Before    int64   `json:"before"`
+}
+
+const (
+	EventMessage   = "message"
+	EventMatch     = "match"
+	EventAck       = "ack"
+	EventTyping    = "typing"
+	EventRead      = "read"
+	EventDelivered = "delivered"
+	EventEdit      = "edit"
+	EventDelete    = "delete"
+	EventError     = "error"
+	// EventGoingAway is sent before the server shuts down, the client should reconnect
+	EventGoingAway = "going_away"
+)
+
+// Event is a unit of the live chat connection, it goes both ways over WebSocket
+// and to the client over SSE.
+type Event struct {
+	Type      string   `json:"type"`
+	UserID    int64    `json:"user_id,omitempty"`
+	ToID      int64    `json:"to_id,omitempty"`
+	MessageID int64    `json:"message_id,omitempty"`
+	ClientID  string   `json:"client_id,omitempty"`
+	Text      string   `json:"text,omitempty"`
+	Message   *Message `json:"message,omitempty"`
+	Error     string   `json:"error,omitempty"`
 }
 
 type Filter struct {
@@ -0,0 +1,31 @@
+package pubsub
+
+import (
+	"context"
+	"sparky-back/internal/models"
+)
+
+// Local delivers events within the process, it is enough for a single instance.
+type Local struct {
+	handler Handler
+}
+
+func NewLocal(handler Handler) *Local {
+	return &Local{
+		handler: handler,
+	}
+}
+
+func (l *Local) Publish(_ context.Context, userID int64, event models.Event) error {
+	l.handler(userID, event)
+	return nil
+}
+
+func (l *Local) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (l *Local) Check(context.Context) error {
+	return nil
+}
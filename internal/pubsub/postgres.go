@@ -0,0 +1,165 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/driver/pgdriver"
+	"go.uber.org/zap"
+	"sparky-back/internal/models"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultChannel = "sparky_events"
+	// postgres refuses NOTIFY payloads of 8000 bytes and more
+	maxPayloadSize = 7999
+
+	minListenBackoff = 100 * time.Millisecond
+	maxListenBackoff = 5 * time.Second
+)
+
+var (
+	ErrPayloadTooLarge = errors.New("event is too large for NOTIFY")
+	ErrNotListening    = errors.New("not listening for notifications")
+)
+
+// Postgres sends events through LISTEN/NOTIFY, so every instance connected
+// to the same database gets them.
+type Postgres struct {
+	db        *bun.DB
+	channel   string
+	handler   Handler
+	connected Connected
+	listening atomic.Bool
+}
+
+// notification refers to the message of the event by id, the message is loaded by the
+// listener, so text and attachments of any size fit the payload.
+type notification struct {
+	UserID    int64        `json:"user_id"`
+	MessageID int64        `json:"message_id,omitempty"`
+	Event     models.Event `json:"event"`
+}
+
+func NewPostgres(db *bun.DB, channel string, handler Handler, connected Connected) *Postgres {
+	if channel == "" {
+		channel = defaultChannel
+	}
+	return &Postgres{
+		db:        db,
+		channel:   channel,
+		handler:   handler,
+		connected: connected,
+	}
+}
+
+func (p *Postgres) Publish(ctx context.Context, userID int64, event models.Event) error {
+	payload, err := encodeNotification(userID, event)
+	if err != nil {
+		return err
+	}
+	if err = pgdriver.Notify(ctx, p.db, p.channel, string(payload)); err != nil {
+		return fmt.Errorf("notify: %w", err)
+	}
+	return nil
+}
+
+// Run listens on the channel until ctx is done. Listen is retried with backoff while
+// the database is unreachable, then the listener reconnects by itself when the connection breaks.
+func (p *Postgres) Run(ctx context.Context) error {
+	ln := pgdriver.NewListener(p.db)
+	if err := p.listen(ctx, ln); err != nil {
+		ln.Close()
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		ln.Close()
+	}()
+	for n := range ln.Channel() {
+		var msg notification
+		if err := json.Unmarshal([]byte(n.Payload), &msg); err != nil {
+			zap.S().With("channel", n.Channel).Error(fmt.Errorf("unmarshaling notification: %w", err))
+			continue
+		}
+		// every instance gets every notification, only the one holding a connection
+		// of the user has to deliver it
+		if !p.connected(msg.UserID) {
+			continue
+		}
+		if msg.MessageID != 0 {
+			message, err := p.loadMessage(ctx, msg.MessageID)
+			if err != nil {
+				zap.S().With("message_id", msg.MessageID).Error(fmt.Errorf("loading message of notification: %w", err))
+				continue
+			}
+			msg.Event.Message = message
+		}
+		p.handler(msg.UserID, msg.Event)
+	}
+	return nil
+}
+
+// Check fails until the listener is up, events of other instances are lost meanwhile.
+func (p *Postgres) Check(context.Context) error {
+	if !p.listening.Load() {
+		return ErrNotListening
+	}
+	return nil
+}
+
+func (p *Postgres) listen(ctx context.Context, ln *pgdriver.Listener) error {
+	backoff := minListenBackoff
+	for attempt := 1; ; attempt++ {
+		err := ln.Listen(ctx, p.channel)
+		if err == nil {
+			p.listening.Store(true)
+			return nil
+		}
+		if ctx.Err() != nil {
+			return fmt.Errorf("listen: %w", err)
+		}
+		zap.S().With("attempt", attempt, "retry_in", backoff).Warn(fmt.Errorf("listen: %w", err))
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return fmt.Errorf("listen: %w", err)
+		}
+		backoff = min(2*backoff, maxListenBackoff)
+	}
+}
+
+func encodeNotification(userID int64, event models.Event) ([]byte, error) {
+	msg := notification{
+		UserID: userID,
+		Event:  event,
+	}
+	if event.Message != nil {
+		msg.MessageID, msg.Event.Message = event.Message.MessageID, nil
+	}
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling json: %w", err)
+	}
+	if len(payload) > maxPayloadSize {
+		return nil, ErrPayloadTooLarge
+	}
+	return payload, nil
+}
+
+func (p *Postgres) loadMessage(ctx context.Context, id int64) (*models.Message, error) {
+	message := new(models.Message)
+	err := p.db.NewSelect().
+		Model(message).
+		Relation("Attachments").
+		Where("m.id = ?", id).
+		Scan(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("select query: %w", err)
+	}
+	return message, nil
+}
@@ -0,0 +1,40 @@
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"sparky-back/internal/models"
+	"strings"
+	"testing"
+)
+
+func TestEncodeNotification(t *testing.T) {
+	event := models.Event{
+		Type: models.EventMessage,
+		Message: &models.Message{
+			MessageID: 7,
+			UserID:    1,
+			ToID:      2,
+			Text:      strings.Repeat("x", 2*maxPayloadSize),
+		},
+	}
+	payload, err := encodeNotification(2, event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg notification
+	if err = json.Unmarshal(payload, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.UserID != 2 || msg.MessageID != 7 || msg.Event.Type != models.EventMessage || msg.Event.Message != nil {
+		t.Errorf("got %+v, want the message replaced with its id", msg)
+	}
+	if event.Message == nil {
+		t.Error("the event of the caller was changed")
+	}
+
+	_, err = encodeNotification(2, models.Event{Type: models.EventTyping, Text: strings.Repeat("x", maxPayloadSize)})
+	if !errors.Is(err, ErrPayloadTooLarge) {
+		t.Errorf("got error %v, want ErrPayloadTooLarge", err)
+	}
+}
@@ -0,0 +1,45 @@
+package pubsub
+
+import (
+	"context"
+	"fmt"
+	"github.com/uptrace/bun"
+	"sparky-back/internal/models"
+)
+
+const (
+	BackendLocal    = "local"
+	BackendPostgres = "postgres"
+)
+
+type Config struct {
+	Backend string `yaml:"backend"`
+	Channel string `yaml:"channel"`
+}
+
+// Handler gets every event published to a user by any instance.
+type Handler func(userID int64, event models.Event)
+
+// Connected tells if the user has a connection to this instance.
+type Connected func(userID int64) bool
+
+// PubSub carries live chat events between instances. Every instance delivers them
+// to its own connections.
+type PubSub interface {
+	Publish(ctx context.Context, userID int64, event models.Event) error
+	// Run receives events until ctx is done.
+	Run(ctx context.Context) error
+	// Check fails while events of other instances can not be received.
+	Check(ctx context.Context) error
+}
+
+func New(cfg Config, db *bun.DB, handler Handler, connected Connected) (PubSub, error) {
+	switch cfg.Backend {
+	case BackendLocal, "":
+		return NewLocal(handler), nil
+	case BackendPostgres:
+		return NewPostgres(db, cfg.Channel, handler, connected), nil
+	default:
+		return nil, fmt.Errorf("unknown pubsub backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,57 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"github.com/uptrace/bun"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var dbTracer = otel.Tracer("sparky-back/internal/tracing/bun")
+
+// QueryHook makes a span for every bun query, a child of the span in the query context.
+// bun formats the arguments into the statement, so spans get only the operation and the table,
+// a statement would send password hashes, emails and message texts to the trace backend.
+type QueryHook struct{}
+
+var _ bun.QueryHook = QueryHook{}
+
+func (QueryHook) BeforeQuery(ctx context.Context, event *bun.QueryEvent) context.Context {
+	ctx, _ = dbTracer.Start(ctx, "db."+event.Operation(),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithTimestamp(event.StartTime),
+	)
+	return ctx
+}
+
+func (QueryHook) AfterQuery(ctx context.Context, event *bun.QueryEvent) {
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		span.End()
+		return
+	}
+	span.SetAttributes(
+		semconv.DBSystemPostgreSQL,
+		semconv.DBOperation(event.Operation()),
+	)
+	if table := queryTable(event); table != "" {
+		span.SetAttributes(semconv.DBSQLTable(table))
+	}
+	if event.Err != nil && !errors.Is(event.Err, sql.ErrNoRows) {
+		span.RecordError(event.Err)
+		span.SetStatus(codes.Error, event.Err.Error())
+	}
+	span.End()
+}
+
+// queryTable is the table of a query built with bun, raw queries have none.
+func queryTable(event *bun.QueryEvent) string {
+	if q, ok := event.IQuery.(interface{ GetTableName() string }); ok {
+		return q.GetTableName()
+	}
+	return ""
+}
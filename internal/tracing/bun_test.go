@@ -0,0 +1,50 @@
+package tracing
+
+import (
+	"context"
+	"github.com/uptrace/bun"
+	"github.com/uptrace/bun/dialect/pgdialect"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"testing"
+	"time"
+)
+
+type secretRow struct {
+	bun.BaseModel `bun:"table:users"`
+	Password      string
+}
+
+func TestQueryHook_NoStatement(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	defer otel.SetTracerProvider(otel.GetTracerProvider())
+	otel.SetTracerProvider(provider)
+
+	db := bun.NewDB(nil, pgdialect.New())
+	q := db.NewInsert().Model(&secretRow{Password: "hunter2"})
+	event := &bun.QueryEvent{
+		IQuery:    q,
+		Query:     q.String(),
+		StartTime: time.Now(),
+	}
+	hook := QueryHook{}
+	hook.AfterQuery(hook.BeforeQuery(context.Background(), event), event)
+
+	ended := spans.Ended()
+	if len(ended) != 1 {
+		t.Fatalf("got %d spans, want 1", len(ended))
+	}
+	attrs := make(map[string]string)
+	for _, attr := range ended[0].Attributes() {
+		attrs[string(attr.Key)] = attr.Value.Emit()
+	}
+	if _, ok := attrs[string(semconv.DBStatementKey)]; ok {
+		t.Errorf("span has the statement with the values: %v", attrs)
+	}
+	if attrs[string(semconv.DBOperationKey)] != "INSERT" || attrs[string(semconv.DBSQLTableKey)] != "users" {
+		t.Errorf("got attributes %v, want the operation and the table", attrs)
+	}
+}
@@ -0,0 +1,38 @@
+package tracing
+
+import (
+	"context"
+	"go.opentelemetry.io/otel"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSetup_File(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), Config{Exporter: ExporterFile, File: file})
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+
+	_, span := otel.Tracer("test").Start(context.Background(), "Logic.GetUserByID")
+	span.End()
+	if err = shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("reading traces: %v", err)
+	}
+	if !strings.Contains(string(data), `"Name":"Logic.GetUserByID"`) {
+		t.Errorf("span is not in the file: %s", data)
+	}
+}
+
+func TestSetup_UnknownExporter(t *testing.T) {
+	if _, err := Setup(context.Background(), Config{Exporter: "jaeger"}); err == nil {
+		t.Error("got no error for an unknown exporter")
+	}
+}
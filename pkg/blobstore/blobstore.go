@@ -0,0 +1,57 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+var (
+	ErrNotExist   = errors.New("blob does not exist")
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+type Config struct {
+	Backend string      `yaml:"backend"`
+	Local   LocalConfig `yaml:"local"`
+	S3      S3Config    `yaml:"s3"`
+}
+
+// BlobStore keeps binary objects, such as user images, under flat string keys.
+type BlobStore interface {
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	Get(ctx context.Context, key string) (*Object, error)
+	Delete(ctx context.Context, key string) error
+	List(ctx context.Context) ([]Info, error)
+}
+
+type Info struct {
+	Key         string
+	Size        int64
+	ModTime     time.Time
+	ContentType string
+}
+
+// Object is an opened blob, it must be closed by the caller.
+type Object struct {
+	io.ReadSeekCloser
+	Info
+}
+
+func New(ctx context.Context, cfg Config) (BlobStore, error) {
+	switch cfg.Backend {
+	case BackendLocal, "":
+		return NewLocal(cfg.Local)
+	case BackendS3:
+		return NewS3(ctx, cfg.S3)
+	default:
+		return nil, fmt.Errorf("unknown blob store backend %q", cfg.Backend)
+	}
+}
@@ -0,0 +1,64 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+// testBlobStore runs the same scenario against any backend.
+func testBlobStore(t *testing.T, store BlobStore) {
+	ctx := context.Background()
+	data := []byte("not really a jpeg")
+
+	err := store.Put(ctx, "photo.jpg", bytes.NewReader(data), int64(len(data)), "image/jpeg")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+
+	obj, err := store.Get(ctx, "photo.jpg")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	got, err := io.ReadAll(obj)
+	obj.Close()
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("got %q, want %q", got, data)
+	}
+	if obj.Size != int64(len(data)) {
+		t.Fatalf("got size %d, want %d", obj.Size, len(data))
+	}
+	if obj.ContentType != "image/jpeg" {
+		t.Fatalf("got content type %q, want image/jpeg", obj.ContentType)
+	}
+
+	infos, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(infos) != 1 || infos[0].Key != "photo.jpg" {
+		t.Fatalf("got list %+v, want only photo.jpg", infos)
+	}
+
+	if err = store.Delete(ctx, "photo.jpg"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err = store.Get(ctx, "photo.jpg"); !errors.Is(err, ErrNotExist) {
+		t.Fatalf("get deleted: got %v, want ErrNotExist", err)
+	}
+	if err = store.Delete(ctx, "photo.jpg"); err != nil {
+		t.Fatalf("delete twice: %v", err)
+	}
+
+	if err = CheckWritable(ctx, store); err != nil {
+		t.Fatalf("check writable: %v", err)
+	}
+	if infos, err = store.List(ctx); err != nil || len(infos) != 0 {
+		t.Fatalf("got list %+v, %v after the probe, want it empty", infos, err)
+	}
+}
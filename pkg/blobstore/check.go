@@ -0,0 +1,22 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+)
+
+// probeKey is never generated for real blobs.
+const probeKey = "writable-probe"
+
+// CheckWritable writes and removes a tiny blob to see that the store accepts writes.
+func CheckWritable(ctx context.Context, store BlobStore) error {
+	data := []byte("ok")
+	if err := store.Put(ctx, probeKey, bytes.NewReader(data), int64(len(data)), "text/plain"); err != nil {
+		return fmt.Errorf("writing probe: %w", err)
+	}
+	if err := store.Delete(ctx, probeKey); err != nil {
+		return fmt.Errorf("removing probe: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package blobstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const defaultLocalDir = "static/"
+
+type LocalConfig struct {
+	Dir string `yaml:"dir"`
+}
+
+// Local stores blobs as files in a single directory.
+type Local struct {
+	dir string
+}
+
+func NewLocal(cfg LocalConfig) (*Local, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		dir = defaultLocalDir
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("creating dir: %w", err)
+	}
+	return &Local{
+		dir: dir,
+	}, nil
+}
+
+func (l *Local) Put(_ context.Context, key string, r io.Reader, _ int64, _ string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first so readers never see a partial blob
+	tmp, err := os.CreateTemp(l.dir, ".upload-*")
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("copying file: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("closing file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("renaming file: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) Get(_ context.Context, key string) (*Object, error) {
+	path, err := l.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("open file: %w", err)
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("stat file: %w", err)
+	}
+	return &Object{
+		ReadSeekCloser: file,
+		Info:           fileInfo(stat),
+	}, nil
+}
+
+func (l *Local) Delete(_ context.Context, key string) error {
+	path, err := l.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("removing file: %w", err)
+	}
+	return nil
+}
+
+func (l *Local) List(_ context.Context) ([]Info, error) {
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return nil, fmt.Errorf("reading dir: %w", err)
+	}
+	infos := make([]Info, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		stat, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		infos = append(infos, fileInfo(stat))
+	}
+	return infos, nil
+}
+
+func (l *Local) path(key string) (string, error) {
+	if key == "" || strings.HasPrefix(key, ".") || filepath.Base(key) != key {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return filepath.Join(l.dir, key), nil
+}
+
+func fileInfo(stat os.FileInfo) Info {
+	return Info{
+		Key:         stat.Name(),
+		Size:        stat.Size(),
+		ModTime:     stat.ModTime(),
+		ContentType: mime.TypeByExtension(filepath.Ext(stat.Name())),
+	}
+}
@@ -0,0 +1,29 @@
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestLocal(t *testing.T) {
+	store, err := NewLocal(LocalConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testBlobStore(t, store)
+}
+
+func TestLocal_InvalidKey(t *testing.T) {
+	store, err := NewLocal(LocalConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "../config.yaml", "a/b.jpg", ".hidden"} {
+		err = store.Put(context.Background(), key, bytes.NewReader(nil), 0, "")
+		if !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("put %q: got %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package blobstore
+
+import (
+	"context"
+	"fmt"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"io"
+)
+
+const noSuchKey = "NoSuchKey"
+
+type S3Config struct {
+	Endpoint  string `yaml:"endpoint"`
+	Region    string `yaml:"region"`
+	Bucket    string `yaml:"bucket"`
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+	// SecretKeyFile is read into SecretKey by the config loader
+	SecretKeyFile string `yaml:"secret_key_file"`
+	UseSSL        bool   `yaml:"use_ssl"`
+}
+
+// S3 stores blobs in a bucket of any S3 compatible service, e.g. AWS S3 or MinIO.
+type S3 struct {
+	client *minio.Client
+	bucket string
+}
+
+// NewS3 connects to the service and creates the bucket if it does not exist yet.
+func NewS3(ctx context.Context, cfg S3Config) (*S3, error) {
+	client, err := minio.New(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating s3 client: %w", err)
+	}
+	exists, err := client.BucketExists(ctx, cfg.Bucket)
+	if err != nil {
+		return nil, fmt.Errorf("checking bucket: %w", err)
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, cfg.Bucket, minio.MakeBucketOptions{Region: cfg.Region})
+		if err != nil {
+			return nil, fmt.Errorf("creating bucket: %w", err)
+		}
+	}
+	return &S3{
+		client: client,
+		bucket: cfg.Bucket,
+	}, nil
+}
+
+// Put uploads the blob. A negative size makes the client buffer whole parts in memory,
+// so the size of seekable readers is measured first.
+func (s *S3) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	if key == "" {
+		return ErrInvalidKey
+	}
+	if seeker, ok := r.(io.Seeker); ok && size < 0 {
+		var err error
+		if size, err = seekerSize(seeker); err != nil {
+			return fmt.Errorf("measuring size: %w", err)
+		}
+	}
+	_, err := s.client.PutObject(ctx, s.bucket, key, r, size, minio.PutObjectOptions{
+		ContentType: contentType,
+	})
+	if err != nil {
+		return fmt.Errorf("put object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) Get(ctx context.Context, key string) (*Object, error) {
+	if key == "" {
+		return nil, ErrInvalidKey
+	}
+	obj, err := s.client.GetObject(ctx, s.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get object: %w", err)
+	}
+	stat, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == noSuchKey {
+			return nil, ErrNotExist
+		}
+		return nil, fmt.Errorf("stat object: %w", err)
+	}
+	return &Object{
+		ReadSeekCloser: obj,
+		Info:           objectInfo(stat),
+	}, nil
+}
+
+func (s *S3) Delete(ctx context.Context, key string) error {
+	if key == "" {
+		return ErrInvalidKey
+	}
+	err := s.client.RemoveObject(ctx, s.bucket, key, minio.RemoveObjectOptions{})
+	if err != nil && minio.ToErrorResponse(err).Code != noSuchKey {
+		return fmt.Errorf("remove object: %w", err)
+	}
+	return nil
+}
+
+func (s *S3) List(ctx context.Context) ([]Info, error) {
+	infos := make([]Info, 0)
+	for obj := range s.client.ListObjects(ctx, s.bucket, minio.ListObjectsOptions{}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("list objects: %w", obj.Err)
+		}
+		infos = append(infos, objectInfo(obj))
+	}
+	return infos, nil
+}
+
+func seekerSize(seeker io.Seeker) (int64, error) {
+	cur, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := seeker.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err = seeker.Seek(cur, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end - cur, nil
+}
+
+func objectInfo(obj minio.ObjectInfo) Info {
+	return Info{
+		Key:         obj.Key,
+		Size:        obj.Size,
+		ModTime:     obj.LastModified,
+		ContentType: obj.ContentType,
+	}
+}
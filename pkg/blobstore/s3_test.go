@@ -0,0 +1,35 @@
+package blobstore
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestS3 needs an S3 compatible server, e.g. a local MinIO:
+//
+//	docker run -p 9000:9000 minio/minio server /data
+//	S3_TEST_ENDPOINT=localhost:9000 S3_TEST_ACCESS_KEY=minioadmin S3_TEST_SECRET_KEY=minioadmin go test ./pkg/blobstore
+func TestS3(t *testing.T) {
+	endpoint := os.Getenv("S3_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("S3_TEST_ENDPOINT is not set")
+	}
+	useSSL, _ := strconv.ParseBool(os.Getenv("S3_TEST_USE_SSL"))
+	store, err := NewS3(context.Background(), S3Config{
+		Endpoint:  endpoint,
+		Bucket:    "sparky-test-" + strconv.FormatInt(time.Now().UnixNano(), 10),
+		AccessKey: os.Getenv("S3_TEST_ACCESS_KEY"),
+		SecretKey: os.Getenv("S3_TEST_SECRET_KEY"),
+		UseSSL:    useSSL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		store.client.RemoveBucket(context.Background(), store.bucket)
+	})
+	testBlobStore(t, store)
+}
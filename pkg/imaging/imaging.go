@@ -0,0 +1,172 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	"golang.org/x/image/webp"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+	FormatWebP = "webp"
+
+	jpegQuality = 90
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported image format")
+	ErrTooLarge          = errors.New("image file is too large")
+	ErrTooManyPixels     = errors.New("image dimensions are too large")
+)
+
+type Limits struct {
+	MaxBytes     int64
+	MaxDimension int
+	MaxPixels    int
+}
+
+// Image is an encoded image without any metadata.
+type Image struct {
+	Data        []byte
+	ContentType string
+	Ext         string
+	Width       int
+	Height      int
+}
+
+type Result struct {
+	Original   Image
+	Thumbnails map[int]Image
+}
+
+// Detect returns the format of the image by its magic bytes.
+func Detect(header []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(header, []byte("\xff\xd8\xff")):
+		return FormatJPEG, nil
+	case bytes.HasPrefix(header, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPNG, nil
+	case len(header) >= 12 && bytes.Equal(header[:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WEBP")):
+		return FormatWebP, nil
+	default:
+		return "", ErrUnsupportedFormat
+	}
+}
+
+// Process validates the uploaded image against limits and re-encodes it, which drops EXIF, GPS
+// and any other metadata. For every size a thumbnail fitting into a size x size box is made,
+// images are never upscaled.
+func Process(r io.Reader, limits Limits, sizes []int) (*Result, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, fmt.Errorf("reading image: %w", err)
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, ErrTooLarge
+	}
+	format, err := Detect(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := decodeConfig(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding image config: %w", err)
+	}
+	if cfg.Width > limits.MaxDimension || cfg.Height > limits.MaxDimension || cfg.Width*cfg.Height > limits.MaxPixels {
+		return nil, ErrTooManyPixels
+	}
+	img, err := decode(format, data)
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	if format == FormatJPEG {
+		img = applyOrientation(img, jpegOrientation(data))
+	}
+
+	// png keeps transparency, everything else is stored as jpeg
+	encodeFormat := FormatJPEG
+	if format == FormatPNG {
+		encodeFormat = FormatPNG
+	}
+	result := &Result{
+		Thumbnails: make(map[int]Image, len(sizes)),
+	}
+	if result.Original, err = encode(encodeFormat, img); err != nil {
+		return nil, fmt.Errorf("encoding image: %w", err)
+	}
+	for _, size := range sizes {
+		thumb, err := encode(encodeFormat, resize(img, size))
+		if err != nil {
+			return nil, fmt.Errorf("encoding %d thumbnail: %w", size, err)
+		}
+		result.Thumbnails[size] = thumb
+	}
+	return result, nil
+}
+
+func decodeConfig(format string, data []byte) (image.Config, error) {
+	switch format {
+	case FormatJPEG:
+		return jpeg.DecodeConfig(bytes.NewReader(data))
+	case FormatPNG:
+		return png.DecodeConfig(bytes.NewReader(data))
+	default:
+		return webp.DecodeConfig(bytes.NewReader(data))
+	}
+}
+
+func decode(format string, data []byte) (image.Image, error) {
+	switch format {
+	case FormatJPEG:
+		return jpeg.Decode(bytes.NewReader(data))
+	case FormatPNG:
+		return png.Decode(bytes.NewReader(data))
+	default:
+		return webp.Decode(bytes.NewReader(data))
+	}
+}
+
+func encode(format string, img image.Image) (Image, error) {
+	buf := new(bytes.Buffer)
+	encoded := Image{
+		Width:  img.Bounds().Dx(),
+		Height: img.Bounds().Dy(),
+	}
+	var err error
+	if format == FormatPNG {
+		err = png.Encode(buf, img)
+		encoded.ContentType, encoded.Ext = "image/png", ".png"
+	} else {
+		err = jpeg.Encode(buf, img, &jpeg.Options{Quality: jpegQuality})
+		encoded.ContentType, encoded.Ext = "image/jpeg", ".jpg"
+	}
+	if err != nil {
+		return Image{}, err
+	}
+	encoded.Data = buf.Bytes()
+	return encoded, nil
+}
+
+func resize(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	if w >= h {
+		w, h = size, max(1, h*size/w)
+	} else {
+		w, h = max(1, w*size/h), size
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,130 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+var testLimits = Limits{
+	MaxBytes:     1 << 20,
+	MaxDimension: 1000,
+	MaxPixels:    500_000,
+}
+
+func testImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.NRGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+// withExif inserts an APP1 segment holding orientation and a fake GPS marker right after SOI.
+func withExif(t *testing.T, jpg []byte, orientation byte) []byte {
+	t.Helper()
+	tiff := []byte{
+		'M', 'M', 0, 42, 0, 0, 0, 8, // header, IFD0 at offset 8
+		0, 1, // one entry
+		0x01, 0x12, 0, 3, 0, 0, 0, 1, 0, orientation, 0, 0, // orientation, SHORT
+		0, 0, 0, 0, // no next IFD
+	}
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	payload = append(payload, []byte("GPS 55.7558 37.6173")...)
+	segment := []byte{0xff, 0xe1, byte((len(payload) + 2) >> 8), byte(len(payload) + 2)}
+	segment = append(segment, payload...)
+	out := append([]byte{}, jpg[:2]...)
+	out = append(out, segment...)
+	return append(out, jpg[2:]...)
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name   string
+		header []byte
+		want   string
+		err    error
+	}{
+		{"jpeg", []byte("\xff\xd8\xff\xe0"), FormatJPEG, nil},
+		{"png", []byte("\x89PNG\r\n\x1a\n...."), FormatPNG, nil},
+		{"webp", []byte("RIFF\x00\x00\x00\x00WEBPVP8 "), FormatWebP, nil},
+		{"gif", []byte("GIF89a"), "", ErrUnsupportedFormat},
+		{"html", []byte("<html>"), "", ErrUnsupportedFormat},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Detect(tt.header)
+			if got != tt.want || !errors.Is(err, tt.err) {
+				t.Errorf("Detect() = %q, %v, want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestProcess_JPEG(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := jpeg.Encode(buf, testImage(300, 200), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := withExif(t, buf.Bytes(), 6)
+
+	res, err := Process(bytes.NewReader(data), testLimits, []int{128, 512})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Original.Width != 200 || res.Original.Height != 300 {
+		t.Errorf("original is %dx%d, want rotated 200x300", res.Original.Width, res.Original.Height)
+	}
+	if bytes.Contains(res.Original.Data, []byte("Exif")) || bytes.Contains(res.Original.Data, []byte("GPS")) {
+		t.Error("original still contains metadata")
+	}
+	if res.Original.ContentType != "image/jpeg" || res.Original.Ext != ".jpg" {
+		t.Errorf("original is %s %s, want image/jpeg .jpg", res.Original.ContentType, res.Original.Ext)
+	}
+	if thumb := res.Thumbnails[128]; thumb.Width != 85 || thumb.Height != 128 {
+		t.Errorf("128 thumbnail is %dx%d, want 85x128", thumb.Width, thumb.Height)
+	}
+	if thumb := res.Thumbnails[512]; thumb.Width != 200 || thumb.Height != 300 {
+		t.Errorf("512 thumbnail is %dx%d, want not upscaled 200x300", thumb.Width, thumb.Height)
+	}
+}
+
+func TestProcess_PNG(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, testImage(64, 32)); err != nil {
+		t.Fatal(err)
+	}
+	res, err := Process(buf, testLimits, []int{16})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Original.ContentType != "image/png" {
+		t.Errorf("got content type %s, want image/png", res.Original.ContentType)
+	}
+	if thumb := res.Thumbnails[16]; thumb.Width != 16 || thumb.Height != 8 {
+		t.Errorf("16 thumbnail is %dx%d, want 16x8", thumb.Width, thumb.Height)
+	}
+}
+
+func TestProcess_Limits(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := png.Encode(buf, testImage(800, 800)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Process(bytes.NewReader(buf.Bytes()), testLimits, nil); !errors.Is(err, ErrTooManyPixels) {
+		t.Errorf("got %v, want ErrTooManyPixels", err)
+	}
+	small := Limits{MaxBytes: 100, MaxDimension: 1000, MaxPixels: 1_000_000}
+	if _, err := Process(bytes.NewReader(buf.Bytes()), small, nil); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("got %v, want ErrTooLarge", err)
+	}
+	if _, err := Process(bytes.NewReader([]byte("GIF89a")), testLimits, nil); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("got %v, want ErrUnsupportedFormat", err)
+	}
+}
@@ -1,13 +1,29 @@
 package recorder
 
 import (
+	"bufio"
+	"errors"
+	"net"
 	"net/http"
+	"time"
 )
 
+var ErrNotHijacker = errors.New("response writer does not support hijacking")
+
+// ResponseRecorder passes the response through and records its status, size and
+// time to first byte. It keeps http.Flusher and http.Hijacker working, so it can wrap
+// SSE and WebSocket handlers. The body is only kept by a capturing recorder, up to its limit.
 type ResponseRecorder struct {
 	http.ResponseWriter
 	Status int
 	Body   []byte
+	// Bytes is the size of the whole body, Truncated tells that Body holds only a part of it
+	Bytes     int64
+	Truncated bool
+	// FirstWrite is when the headers or the first bytes of the body were written
+	FirstWrite   time.Time
+	captureLimit int
+	hijacked     bool
 }
 
 func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
@@ -16,18 +32,90 @@ func NewResponseRecorder(w http.ResponseWriter) *ResponseRecorder {
 	}
 }
 
+// NewCapturingRecorder keeps the first limit bytes of the body in Body.
+func NewCapturingRecorder(w http.ResponseWriter, limit int) *ResponseRecorder {
+	return &ResponseRecorder{
+		ResponseWriter: w,
+		captureLimit:   limit,
+	}
+}
+
 func (r *ResponseRecorder) WriteHeader(status int) {
-	r.Status = status
+	if r.Status == 0 {
+		r.Status = status
+		r.markFirstWrite()
+	}
 	r.ResponseWriter.WriteHeader(status)
 }
 
 func (r *ResponseRecorder) Write(data []byte) (int, error) {
-	r.Body = append(r.Body, data...)
-	return r.ResponseWriter.Write(data)
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	r.markFirstWrite()
+	n, err := r.ResponseWriter.Write(data)
+	r.Bytes += int64(n)
+	if room := r.captureLimit - len(r.Body); room > 0 {
+		r.Body = append(r.Body, data[:min(n, room)]...)
+	}
+	r.Truncated = r.captureLimit > 0 && r.Bytes > int64(len(r.Body))
+	return n, err
+}
+
+func (r *ResponseRecorder) Flush() {
+	if r.Status == 0 {
+		r.Status = http.StatusOK
+	}
+	r.markFirstWrite()
+	if f, ok := r.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (r *ResponseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, ErrNotHijacker
+	}
+	conn, rw, err := h.Hijack()
+	if err == nil {
+		r.hijacked = true
+		r.markFirstWrite()
+	}
+	return conn, rw, err
+}
+
+// Unwrap lets http.ResponseController reach the wrapped writer.
+func (r *ResponseRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+func (r *ResponseRecorder) markFirstWrite() {
+	if r.FirstWrite.IsZero() {
+		r.FirstWrite = time.Now()
+	}
+}
+
+// Hijacked tells that the handler took the connection over, as WebSocket upgrades do.
+func (r *ResponseRecorder) Hijacked() bool {
+	return r.hijacked
+}
+
+// StatusCode is the status the client got: 200 if the handler wrote nothing,
+// 101 for a hijacked connection.
+func (r *ResponseRecorder) StatusCode() int {
+	switch {
+	case r.hijacked:
+		return http.StatusSwitchingProtocols
+	case r.Status == 0:
+		return http.StatusOK
+	default:
+		return r.Status
+	}
 }
 
 func (r *ResponseRecorder) IsDefault() bool {
-	return r.Status == 0
+	return r.Status == 0 && !r.hijacked
 }
 
 func (r *ResponseRecorder) GetBody() string {
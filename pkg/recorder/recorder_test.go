@@ -0,0 +1,61 @@
+package recorder
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestResponseRecorder_Streaming(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := NewResponseRecorder(rec)
+
+	if got := r.StatusCode(); got != http.StatusOK || !r.IsDefault() {
+		t.Errorf("got status %d before writing, want default 200", got)
+	}
+	flusher, ok := any(r).(http.Flusher)
+	if !ok {
+		t.Fatal("recorder hides http.Flusher")
+	}
+	r.WriteHeader(http.StatusNotFound)
+	r.WriteHeader(http.StatusInternalServerError)
+	r.Write([]byte("event: message\n\n"))
+	flusher.Flush()
+
+	if got := r.StatusCode(); got != http.StatusNotFound {
+		t.Errorf("got status %d, want the first one, 404", got)
+	}
+	if !rec.Flushed {
+		t.Error("Flush did not reach the underlying writer")
+	}
+	if r.Bytes != 16 || len(r.Body) != 0 {
+		t.Errorf("got %d bytes and body %q, want 16 bytes and nothing captured", r.Bytes, r.Body)
+	}
+	if r.FirstWrite.IsZero() {
+		t.Error("first write time is not set")
+	}
+	if _, _, err := r.Hijack(); err != ErrNotHijacker {
+		t.Errorf("got %v from Hijack, want ErrNotHijacker", err)
+	}
+	if r.Unwrap() != rec {
+		t.Error("Unwrap does not return the wrapped writer")
+	}
+}
+
+func TestResponseRecorder_Capture(t *testing.T) {
+	rec := httptest.NewRecorder()
+	r := NewCapturingRecorder(rec, 8)
+
+	r.Write([]byte("{\"error\":"))
+	r.Write([]byte("\"bad\"}"))
+
+	if got := r.GetBody(); got != "{\"error\"" {
+		t.Errorf("got body %q, want the first 8 bytes", got)
+	}
+	if !r.Truncated || r.Bytes != 15 {
+		t.Errorf("got truncated %v and %d bytes, want true and 15", r.Truncated, r.Bytes)
+	}
+	if got := rec.Body.String(); got != "{\"error\":\"bad\"}" {
+		t.Errorf("client got %q, want the whole body", got)
+	}
+}
@@ -0,0 +1,78 @@
+package urlsign
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const (
+	ExpiresParam   = "expires"
+	SignatureParam = "sig"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid url signature")
+	ErrExpired          = errors.New("url expired")
+)
+
+// Signer makes urls that stop working after ttl.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+func New(secret []byte, ttl time.Duration) *Signer {
+	return &Signer{
+		secret: secret,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Sign appends expires and sig params to path. The expiry is rounded up to half of ttl,
+// so the url stays the same for a while and clients can cache the file by url.
+func (s *Signer) Sign(path string) string {
+	return path + "?" + s.Params(path).Encode()
+}
+
+// Params returns the expires and sig params Sign adds, for urls that have a query of their own.
+// The path passed to Verify must then include that query.
+func (s *Signer) Params(path string) url.Values {
+	step := int64(s.ttl/2/time.Second) + 1
+	expires := s.now().Add(s.ttl).Unix()
+	expires += step - expires%step
+	query := url.Values{}
+	query.Set(ExpiresParam, strconv.FormatInt(expires, 10))
+	query.Set(SignatureParam, s.signature(path, expires))
+	return query
+}
+
+// Verify checks the params of a url made by Sign for the same path and returns its expiry.
+func (s *Signer) Verify(path, expiresStr, sig string) (time.Time, error) {
+	expires, err := strconv.ParseInt(expiresStr, 10, 64)
+	if err != nil {
+		return time.Time{}, ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(s.signature(path, expires))) {
+		return time.Time{}, ErrInvalidSignature
+	}
+	expiresAt := time.Unix(expires, 0)
+	if s.now().After(expiresAt) {
+		return time.Time{}, ErrExpired
+	}
+	return expiresAt, nil
+}
+
+func (s *Signer) signature(path string, expires int64) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(path))
+	mac.Write([]byte{0})
+	mac.Write([]byte(strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
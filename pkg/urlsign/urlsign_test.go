@@ -0,0 +1,49 @@
+package urlsign
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSigner(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	signer := New([]byte("secret"), time.Hour)
+	signer.now = func() time.Time { return now }
+
+	signed := signer.Sign("/static/a.jpg")
+	path, rawQuery, _ := strings.Cut(signed, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expires, sig := query.Get(ExpiresParam), query.Get(SignatureParam)
+
+	expiresAt, err := signer.Verify(path, expires, sig)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if ttl := expiresAt.Sub(now); ttl < time.Hour || ttl > 90*time.Minute+time.Second {
+		t.Errorf("url lives %v, want between 1h and 1h30m", ttl)
+	}
+	if again := signer.Sign("/static/a.jpg"); again != signed {
+		t.Errorf("signing twice gave %q and %q, want the same url", signed, again)
+	}
+
+	if _, err = signer.Verify("/static/b.jpg", expires, sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other path: got %v, want ErrInvalidSignature", err)
+	}
+	if _, err = signer.Verify(path, "9999999999", sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("changed expiry: got %v, want ErrInvalidSignature", err)
+	}
+	if _, err = New([]byte("other"), time.Hour).Verify(path, expires, sig); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("other secret: got %v, want ErrInvalidSignature", err)
+	}
+
+	now = expiresAt.Add(time.Second)
+	if _, err = signer.Verify(path, expires, sig); !errors.Is(err, ErrExpired) {
+		t.Errorf("after expiry: got %v, want ErrExpired", err)
+	}
+}
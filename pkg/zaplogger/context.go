@@ -0,0 +1,21 @@
+package zaplogger
+
+import (
+	"context"
+	"go.uber.org/zap"
+)
+
+type ctxKey struct{}
+
+// WithLogger returns a copy of ctx carrying logger, FromContext gets it back.
+func WithLogger(ctx context.Context, logger *zap.SugaredLogger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext returns the logger of the request, the global one outside of requests.
+func FromContext(ctx context.Context) *zap.SugaredLogger {
+	if logger, ok := ctx.Value(ctxKey{}).(*zap.SugaredLogger); ok {
+		return logger
+	}
+	return zap.S()
+}